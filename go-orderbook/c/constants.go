@@ -0,0 +1,103 @@
+package c
+
+// OrderType determines how long an order stays in the book and how it is matched
+type OrderType int
+
+const (
+	GoodTillCancel OrderType = iota
+	FillAndKill
+	Market
+	FillOrKill
+	GoodTillDate
+	GoodForDay
+)
+
+func (o OrderType) String() string {
+	switch o {
+	case GoodTillCancel:
+		return "GoodTillCancel"
+	case FillAndKill:
+		return "FillAndKill"
+	case Market:
+		return "Market"
+	case FillOrKill:
+		return "FillOrKill"
+	case GoodTillDate:
+		return "GoodTillDate"
+	case GoodForDay:
+		return "GoodForDay"
+	}
+	return "Unknown"
+}
+
+// Side of the book an order rests on
+type Side int
+
+const (
+	BUY Side = iota
+	SELL
+)
+
+func (s Side) String() string {
+	if s == BUY {
+		return "BUY"
+	}
+	return "SELL"
+}
+
+// SelfTradePrevention decides what happens when two orders of the same owner would match.
+// The newest order is the incoming one, the oldest the one already resting
+type SelfTradePrevention int
+
+const (
+	CancelNewest SelfTradePrevention = iota
+	CancelOldest
+	CancelBoth
+	// DecrementAndCancel reduces both orders by the smaller quantity without trading,
+	// whichever order reaches zero is cancelled
+	DecrementAndCancel
+	AllowSelfTrade
+)
+
+func (s SelfTradePrevention) String() string {
+	switch s {
+	case CancelNewest:
+		return "CancelNewest"
+	case CancelOldest:
+		return "CancelOldest"
+	case CancelBoth:
+		return "CancelBoth"
+	case DecrementAndCancel:
+		return "DecrementAndCancel"
+	case AllowSelfTrade:
+		return "AllowSelfTrade"
+	}
+	return "Unknown"
+}
+
+// PostOnly keeps an order from taking liquidity when it enters the book
+type PostOnly int
+
+const (
+	PostOnlyOff PostOnly = iota
+	// PostOnlyReject refuses an order that would cross
+	PostOnlyReject
+	// PostOnlySlide re-prices an order that would cross one tick behind the opposite best price
+	PostOnlySlide
+)
+
+func (p PostOnly) String() string {
+	switch p {
+	case PostOnlyOff:
+		return "PostOnlyOff"
+	case PostOnlyReject:
+		return "PostOnlyReject"
+	case PostOnlySlide:
+		return "PostOnlySlide"
+	}
+	return "Unknown"
+}
+
+type Price float64
+type Quantity uint64
+type OrderID uint64
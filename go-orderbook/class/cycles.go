@@ -0,0 +1,211 @@
+package class
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"orderbook.com/m/fixed"
+)
+
+// ElementaryCycles enumerates every elementary cycle of a directed graph with Johnson's
+// algorithm, a cycle visits each vertex at most once. A maxLength above zero skips the cycles
+// with more vertices. Vertices are visited in sorted order, so the same graph always gives the
+// same cycles in the same order: each cycle starts at its lowest vertex and the cycles of a start
+// follow the sorted successors. Self loops are not cycles, no order sells a token for itself
+func ElementaryCycles(adjacency map[string][]string, maxLength int) [][]string {
+	seen := make(map[string]bool)
+	vertices := []string{}
+	for from, tos := range adjacency {
+		for _, vertex := range append([]string{from}, tos...) {
+			if !seen[vertex] {
+				seen[vertex] = true
+				vertices = append(vertices, vertex)
+			}
+		}
+	}
+	sort.Strings(vertices)
+
+	index := make(map[string]int, len(vertices))
+	for i, vertex := range vertices {
+		index[vertex] = i
+	}
+
+	succ := make([][]int, len(vertices))
+	for from, tos := range adjacency {
+		v := index[from]
+		for _, to := range tos {
+			if w := index[to]; w != v {
+				succ[v] = append(succ[v], w)
+			}
+		}
+		sort.Ints(succ[v])
+		succ[v] = dedupe(succ[v])
+	}
+
+	j := &johnson{
+		succ:      succ,
+		maxLength: maxLength,
+		blocked:   make([]bool, len(vertices)),
+		blockMap:  make([]map[int]bool, len(vertices)),
+	}
+
+	cycles := [][]string{}
+	for start := range vertices {
+		j.component = strongComponent(succ, start)
+		if len(j.component) < 2 {
+			continue
+		}
+
+		j.start = start
+		for v := range j.component {
+			j.blocked[v] = false
+			j.blockMap[v] = make(map[int]bool)
+		}
+		j.circuit(start)
+
+		for _, cycle := range j.cycles {
+			path := make([]string, len(cycle))
+			for i, v := range cycle {
+				path[i] = vertices[v]
+			}
+			cycles = append(cycles, path)
+		}
+		j.cycles = nil
+	}
+	return cycles
+}
+
+func dedupe(sorted []int) []int {
+	out := sorted[:0]
+	for i, v := range sorted {
+		if i == 0 || v != sorted[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// strongComponent returns the strongly connected component of start in the subgraph of the
+// vertices from start up, the vertices start reaches that also reach it back
+func strongComponent(succ [][]int, start int) map[int]bool {
+	pred := make([][]int, len(succ))
+	for v, tos := range succ {
+		if v < start {
+			continue
+		}
+		for _, w := range tos {
+			if w >= start {
+				pred[w] = append(pred[w], v)
+			}
+		}
+	}
+
+	walk := func(edges [][]int) map[int]bool {
+		reached := map[int]bool{start: true}
+		queue := []int{start}
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			for _, w := range edges[v] {
+				if w >= start && !reached[w] {
+					reached[w] = true
+					queue = append(queue, w)
+				}
+			}
+		}
+		return reached
+	}
+
+	forward, backward := walk(succ), walk(pred)
+	component := make(map[int]bool)
+	for v := range forward {
+		if backward[v] {
+			component[v] = true
+		}
+	}
+	return component
+}
+
+// johnson holds the search state of one start vertex
+type johnson struct {
+	succ      [][]int
+	maxLength int
+
+	start     int
+	component map[int]bool
+	blocked   []bool
+	blockMap  []map[int]bool
+	stack     []int
+	cycles    [][]int
+}
+
+// circuit extends the path with v and reports whether a cycle was closed below it. A path cut by
+// the maximum length counts as closed, so v is unblocked and later paths may still reach it
+func (j *johnson) circuit(v int) bool {
+	closed := false
+	j.stack = append(j.stack, v)
+	j.blocked[v] = true
+
+	for _, w := range j.succ[v] {
+		if !j.component[w] {
+			continue
+		}
+		if w == j.start {
+			j.cycles = append(j.cycles, append([]int(nil), j.stack...))
+			closed = true
+		} else if !j.blocked[w] {
+			if j.maxLength > 0 && len(j.stack) >= j.maxLength {
+				closed = true
+				continue
+			}
+			if j.circuit(w) {
+				closed = true
+			}
+		}
+	}
+
+	if closed {
+		j.unblock(v)
+	} else {
+		for _, w := range j.succ[v] {
+			if j.component[w] {
+				j.blockMap[w][v] = true
+			}
+		}
+	}
+
+	j.stack = j.stack[:len(j.stack)-1]
+	return closed
+}
+
+func (j *johnson) unblock(v int) {
+	j.blocked[v] = false
+	for w := range j.blockMap[v] {
+		delete(j.blockMap[v], w)
+		if j.blocked[w] {
+			j.unblock(w)
+		}
+	}
+}
+
+// ScoreCycle scores a ring from the prices of its legs, leg i asking prices[i] of the next token
+// per token it sells. Every token that goes around the ring has to pay for the product of the
+// prices, so the score is 1e18 minus that product: the share of each token routed through the
+// ring that is left over. A ring only clears on chain with a score of zero or more, and a higher
+// score leaves more room for the rounding of DEX._multiply. The product is rounded up
+func ScoreCycle(prices []*big.Int) (*big.Int, error) {
+	if len(prices) < 2 {
+		return nil, fmt.Errorf("a ring needs at least two legs, got %v", len(prices))
+	}
+
+	product := fixed.One()
+	for i, price := range prices {
+		var err error
+		product, err = fixed.Mul(product, price, fixed.Ceil)
+		if err != nil {
+			return nil, fmt.Errorf("leg %v: %w", i, err)
+		}
+	}
+	return product.Sub(fixed.One(), product), nil
+}
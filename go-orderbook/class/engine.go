@@ -0,0 +1,188 @@
+package class
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"orderbook.com/m/c"
+)
+
+// ErrEngineStopped is the result of every command sent after Stop
+var ErrEngineStopped = errors.New("engine is stopped")
+
+// DefaultCommandBuffer is the number of commands that can be queued before senders block
+const DefaultCommandBuffer = 1024
+
+// Result is the outcome of one command. Sequence is the number of the state change the command
+// made, it is zero when the command left the book untouched. A failed command still gets one
+// when it changed the book, for instance by pruning expired orders first
+type Result struct {
+	Sequence uint64
+	Trades   Trades
+	Expired  []ExpiryEvent
+	Err      error
+}
+
+// Future is completed by the engine goroutine once the command has been applied
+type Future struct {
+	done   chan struct{}
+	result Result
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+func (f *Future) complete(result Result) {
+	f.result = result
+	close(f.done)
+}
+
+// Done is closed once the result is available
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the command has been applied
+func (f *Future) Wait() Result {
+	<-f.done
+	return f.result
+}
+
+// Snapshot is an immutable view of the book published after every state change
+type Snapshot struct {
+	Sequence   uint64
+	Size       int
+	LevelInfos OrderbookLevelInfos
+}
+
+type command struct {
+	apply  func(ob *Orderbook) Result
+	future *Future
+}
+
+// Engine runs an Orderbook on a single writer goroutine. Submit, Cancel, Modify and Prune queue
+// a command and return a Future, commands are applied one at a time in the order they were
+// queued and every one that changes the book gets the next sequence number. Readers never touch
+// the book, they load the latest Snapshot which is swapped atomically after each change.
+// Engine is a library entry point, the keeper drives its registry books directly
+type Engine struct {
+	book     *Orderbook
+	commands chan command
+	depth    int
+
+	// mu guards stopped so that no command is sent once the channel is closed
+	mu      sync.RWMutex
+	stopped bool
+	done    chan struct{}
+
+	sequence atomic.Uint64
+	snapshot atomic.Pointer[Snapshot]
+}
+
+// NewEngine starts the writer goroutine of the book. Snapshots hold depth levels per side,
+// every level when depth <= 0. The book must not be used directly once the engine owns it
+func NewEngine(book *Orderbook, depth int) *Engine {
+	e := &Engine{
+		book:     book,
+		commands: make(chan command, DefaultCommandBuffer),
+		depth:    depth,
+		done:     make(chan struct{}),
+	}
+	e.publish()
+
+	go e.run()
+	return e
+}
+
+func (e *Engine) run() {
+	defer close(e.done)
+
+	for cmd := range e.commands {
+		version := e.book.GetVersion()
+		result := cmd.apply(e.book)
+		if e.book.GetVersion() != version {
+			result.Sequence = e.sequence.Add(1)
+			e.publish()
+		}
+		cmd.future.complete(result)
+	}
+}
+
+func (e *Engine) publish() {
+	e.snapshot.Store(&Snapshot{
+		Sequence:   e.sequence.Load(),
+		Size:       e.book.Size(),
+		LevelInfos: e.book.GetLevelInfos(e.depth, 0),
+	})
+}
+
+// send queues the command, the book's version tells whether it changed the book
+func (e *Engine) send(apply func(ob *Orderbook) Result) *Future {
+	future := newFuture()
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.stopped {
+		future.complete(Result{Err: ErrEngineStopped})
+		return future
+	}
+
+	e.commands <- command{apply: apply, future: future}
+	return future
+}
+
+// Submit adds the order to the book
+func (e *Engine) Submit(order *Order) *Future {
+	return e.send(func(ob *Orderbook) Result {
+		trades, err := ob.AddOrder(order)
+		return Result{Trades: trades, Err: err}
+	})
+}
+
+func (e *Engine) Cancel(orderID c.OrderID) *Future {
+	return e.send(func(ob *Orderbook) Result {
+		err := ob.CancelOrder(orderID)
+		return Result{Err: err}
+	})
+}
+
+func (e *Engine) Modify(orderID c.OrderID, side c.Side, price c.Price, quantity c.Quantity) *Future {
+	return e.send(func(ob *Orderbook) Result {
+		trades, err := ob.ModifyOrder(orderID, side, price, quantity)
+		return Result{Trades: trades, Err: err}
+	})
+}
+
+// Prune drops expired orders, it is only a state change when something expired
+func (e *Engine) Prune() *Future {
+	return e.send(func(ob *Orderbook) Result {
+		return Result{Expired: ob.PruneExpiredOrders()}
+	})
+}
+
+// Snapshot returns the view of the book after the latest state change, it is safe to call from
+// any goroutine and never waits for the writer
+func (e *Engine) Snapshot() *Snapshot {
+	return e.snapshot.Load()
+}
+
+// GetSequence returns the sequence number of the latest state change
+func (e *Engine) GetSequence() uint64 {
+	return e.sequence.Load()
+}
+
+// Stop lets the writer apply every queued command and waits for it to exit. Commands sent
+// afterwards fail with ErrEngineStopped
+func (e *Engine) Stop() {
+	e.mu.Lock()
+	if !e.stopped {
+		e.stopped = true
+		close(e.commands)
+	}
+	e.mu.Unlock()
+
+	<-e.done
+}
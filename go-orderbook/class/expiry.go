@@ -0,0 +1,152 @@
+package class
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+
+	"orderbook.com/m/c"
+)
+
+// DefaultSessionCutoff is the time of day GoodForDay orders expire at
+const DefaultSessionCutoff = 16 * time.Hour
+
+// ExpiryEvent reports an order the book removed because it expired
+type ExpiryEvent struct {
+	OrderId           c.OrderID
+	Side              c.Side
+	Price             c.Price
+	RemainingQuantity c.Quantity
+	Expiry            time.Time
+}
+
+// expiryQueue is a min heap of orders by expiry. Entries are not removed on fill or cancel,
+// the pruner skips any order that is no longer the one resting under its ID
+type expiryQueue []*Order
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].GetExpiry().Before(q[j].GetExpiry()) }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *expiryQueue) Push(x any) {
+	*q = append(*q, x.(*Order))
+}
+
+func (q *expiryQueue) Pop() any {
+	old := *q
+	order := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return order
+}
+
+func (q *expiryQueue) push(order *Order) {
+	heap.Push(q, order)
+}
+
+// SetClock replaces the time source used for expiry
+func (ob *Orderbook) SetClock(clock Clock) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ob.clock = clock
+}
+
+// SetSessionCutoff sets the time of day, in the clock's location, GoodForDay orders expire at
+func (ob *Orderbook) SetSessionCutoff(cutoff time.Duration) error {
+	if cutoff < 0 || cutoff >= 24*time.Hour {
+		return fmt.Errorf("session cutoff (%v) must be within a day", cutoff)
+	}
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ob.sessionCutoff = cutoff
+	return nil
+}
+
+// nextSessionCutoff returns the first cutoff strictly after now
+func (ob *Orderbook) nextSessionCutoff(now time.Time) time.Time {
+	year, month, day := now.Date()
+
+	cutoff := time.Date(year, month, day, 0, 0, 0, 0, now.Location()).Add(ob.sessionCutoff)
+	if !now.Before(cutoff) {
+		cutoff = time.Date(year, month, day+1, 0, 0, 0, 0, now.Location()).Add(ob.sessionCutoff)
+	}
+	return cutoff
+}
+
+// PruneExpiredOrders removes every order that expired by now and returns an event for each,
+// including the ones dropped while adding orders since the last call
+func (ob *Orderbook) PruneExpiredOrders() []ExpiryEvent {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	events := append(ob.expired, ob.pruneExpired(ob.clock.Now())...)
+	ob.expired = nil
+	return events
+}
+
+func (ob *Orderbook) pruneExpired(now time.Time) []ExpiryEvent {
+	events := []ExpiryEvent{}
+
+	for ob.expiries.Len() > 0 && !ob.expiries[0].GetExpiry().After(now) {
+		order := heap.Pop(&ob.expiries).(*Order)
+
+		// already filled, cancelled or replaced by a modify
+		if ob.orders[order.GetOrderID()] != order {
+			continue
+		}
+
+		ob.cancelOrder(order.GetOrderID())
+		events = append(events, ExpiryEvent{
+			OrderId:           order.GetOrderID(),
+			Side:              order.GetSide(),
+			Price:             order.GetPrice(),
+			RemainingQuantity: order.GetRemainingQuantity(),
+			Expiry:            order.GetExpiry(),
+		})
+	}
+
+	return events
+}
+
+// StartPruner prunes expired orders every interval on its own goroutine and sends an event
+// for each removed order, it waits on the clock the book had when it started. The returned
+// stop function ends the pruner and closes the channel
+func (ob *Orderbook) StartPruner(interval time.Duration) (<-chan ExpiryEvent, func()) {
+	events := make(chan ExpiryEvent, 64)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	ob.mu.Lock()
+	clock := ob.clock
+	ob.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		defer close(events)
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-clock.After(interval):
+				for _, event := range ob.PruneExpiredOrders() {
+					select {
+					case events <- event:
+					case <-stop:
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() { close(stop) })
+		<-done
+	}
+}
@@ -0,0 +1,45 @@
+package class
+
+import "fmt"
+
+// FeeSchedule holds the maker and taker fee rates in basis points. A negative maker rate is a
+// rebate, it can never be larger than what the taker pays
+type FeeSchedule struct {
+	MakerFeeBps float64
+	TakerFeeBps float64
+}
+
+func (f FeeSchedule) validate() error {
+	if f.TakerFeeBps < 0 || f.TakerFeeBps >= 10000 {
+		return fmt.Errorf("taker fee (%v bps) must be within [0, 10000)", f.TakerFeeBps)
+	}
+	if f.MakerFeeBps >= 10000 || f.MakerFeeBps < -f.TakerFeeBps {
+		return fmt.Errorf("maker fee (%v bps) must be below 10000 and the rebate cannot exceed the taker fee", f.MakerFeeBps)
+	}
+	return nil
+}
+
+// fees returns what the maker and the taker pay on the given notional
+func (f FeeSchedule) fees(notional float64) (float64, float64) {
+	return notional * f.MakerFeeBps / 10000, notional * f.TakerFeeBps / 10000
+}
+
+// SetFeeSchedule changes the fees charged on every following trade
+func (ob *Orderbook) SetFeeSchedule(schedule FeeSchedule) error {
+	if err := schedule.validate(); err != nil {
+		return err
+	}
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ob.fees = schedule
+	return nil
+}
+
+func (ob *Orderbook) GetFeeSchedule() FeeSchedule {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return ob.fees
+}
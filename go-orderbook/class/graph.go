@@ -0,0 +1,67 @@
+package class
+
+// Graph is an undirected graph of tokens, an edge means a pair can be traded
+type Graph struct {
+	nodes map[string][]string
+}
+
+// NewGraph creates and returns a new undirected graph
+func NewGraph() *Graph {
+	return &Graph{
+		nodes: make(map[string][]string),
+	}
+}
+
+func (g *Graph) GetNodes() map[string][]string {
+	return g.nodes
+}
+
+// AddEdges connects A and B in both directions
+func (g *Graph) AddEdges(A, B string) {
+	g.nodes[A] = append(g.nodes[A], B)
+	g.nodes[B] = append(g.nodes[B], A)
+}
+
+// DeleteEdge removes the edge between A and B, missing edges are ignored
+func (g *Graph) DeleteEdge(A, B string) {
+	g.nodes[A] = removeNeighbor(g.nodes[A], B)
+	g.nodes[B] = removeNeighbor(g.nodes[B], A)
+}
+
+func removeNeighbor(neighbors []string, target string) []string {
+	for i, neighbor := range neighbors {
+		if neighbor == target {
+			return append(neighbors[:i], neighbors[i+1:]...)
+		}
+	}
+	return neighbors
+}
+
+// HasCycle reports whether any connected component contains a cycle
+func (g *Graph) HasCycle() bool {
+	visited := make(map[string]bool)
+
+	for node := range g.nodes {
+		if !visited[node] && g.hasCycleHelper(node, "", visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCycleHelper walks the graph depth first, reaching a visited node that is not
+// the one we came from means there is a cycle
+func (g *Graph) hasCycleHelper(v, parent string, visited map[string]bool) bool {
+	visited[v] = true
+
+	for _, neighbor := range g.nodes[v] {
+		if !visited[neighbor] {
+			if g.hasCycleHelper(neighbor, v, visited) {
+				return true
+			}
+		} else if neighbor != parent {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package class
+
+import (
+	"math"
+
+	"orderbook.com/m/c"
+)
+
+// LevelInfo aggregates every order resting at one price
+type LevelInfo struct {
+	Price    c.Price
+	Quantity c.Quantity
+	Count    int
+}
+
+type LevelInfos []LevelInfo
+
+// OrderbookLevelInfos is a depth snapshot of both sides, best level first
+type OrderbookLevelInfos struct {
+	bids LevelInfos
+	asks LevelInfos
+}
+
+func NewOrderbookLevelInfos(bids, asks LevelInfos) OrderbookLevelInfos {
+	return OrderbookLevelInfos{
+		bids: bids,
+		asks: asks,
+	}
+}
+
+func (o OrderbookLevelInfos) GetBids() LevelInfos {
+	return o.bids
+}
+
+func (o OrderbookLevelInfos) GetAsks() LevelInfos {
+	return o.asks
+}
+
+// tickEpsilon is the relative float error a price may carry and still sit on a tick,
+// 0.3/0.1 is 2.9999999999999996 and belongs to the bucket of 3 ticks
+const tickEpsilon = 1e-12
+
+// bucketTicks returns the ticks of the bucket holding price, rounded down for bids and up for asks
+func bucketTicks(price, tickSize c.Price, down bool) float64 {
+	ticks := float64(price / tickSize)
+	if nearest := math.Round(ticks); math.Abs(ticks-nearest) <= tickEpsilon*math.Max(1, math.Abs(ticks)) {
+		return nearest
+	}
+	if down {
+		return math.Floor(ticks)
+	}
+	return math.Ceil(ticks)
+}
+
+// bucketPrice turns ticks back into a price. A tick that divides the unit is applied as a
+// division so 3 ticks of 0.1 read 0.3 and not 0.30000000000000004
+func bucketPrice(ticks float64, tickSize c.Price) c.Price {
+	perUnit := 1 / float64(tickSize)
+	if nearest := math.Round(perUnit); nearest >= 1 && math.Abs(perUnit-nearest) <= tickEpsilon*nearest {
+		return c.Price(ticks / nearest)
+	}
+	return c.Price(ticks) * tickSize
+}
+
+// levelInfos aggregates the levels of one side from best to worst. Levels are merged into
+// buckets of tickSize when it is positive, bids round down and asks round up so a bucket never
+// looks better than the orders inside it. At most depth levels are returned when depth is positive
+func (sm *SortedMap) levelInfos(depth int, tickSize c.Price) LevelInfos {
+	infos := LevelInfos{}
+
+	for node := sm.levels.first(); node != nil; node = node.next[0] {
+		price := node.price
+		if tickSize > 0 {
+			price = bucketPrice(bucketTicks(price, tickSize, sm.isDescending), tickSize)
+		}
+
+		// levels are visited in order so levels sharing a bucket are always adjacent
+		if len(infos) > 0 && infos[len(infos)-1].Price == price {
+			infos[len(infos)-1].Quantity += node.quantity
+			infos[len(infos)-1].Count += node.count
+			continue
+		}
+
+		if depth > 0 && len(infos) == depth {
+			break
+		}
+		infos = append(infos, LevelInfo{Price: price, Quantity: node.quantity, Count: node.count})
+	}
+
+	return infos
+}
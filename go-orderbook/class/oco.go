@@ -0,0 +1,187 @@
+package class
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"orderbook.com/m/c"
+)
+
+// OCOGroups links orders so that a fill of one cancels the others, typically a take-profit limit
+// and a protective stop on the same position. A book cancels the siblings it holds as soon as one
+// of them trades, the keeper stops triggering the siblings of an order it executed on chain.
+// Books fill off-chain, so they never share the keeper's groups. DEX.cancelOrder only accepts the
+// owner, so a cancelled sibling stays open on chain until its owner cancels it and is kept out of
+// every snapshot
+type OCOGroups struct {
+	mu sync.Mutex
+
+	nextGroup uint64
+	groups    map[uint64][]c.OrderID
+	members   map[c.OrderID]uint64
+	cancelled map[c.OrderID]bool
+}
+
+func NewOCOGroups() *OCOGroups {
+	return &OCOGroups{
+		nextGroup: 1,
+		groups:    make(map[uint64][]c.OrderID),
+		members:   make(map[c.OrderID]uint64),
+		cancelled: make(map[c.OrderID]bool),
+	}
+}
+
+// Link puts the orders in a new group and returns its ID, an order can only be in one group
+func (g *OCOGroups) Link(orderIDs ...c.OrderID) (uint64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(orderIDs) < 2 {
+		return 0, fmt.Errorf("an OCO group needs at least two orders, got %v", len(orderIDs))
+	}
+
+	seen := make(map[c.OrderID]bool, len(orderIDs))
+	for _, orderID := range orderIDs {
+		if seen[orderID] {
+			return 0, fmt.Errorf("order (%v) is listed twice", orderID)
+		}
+		if _, ok := g.members[orderID]; ok {
+			return 0, fmt.Errorf("order (%v) is already in an OCO group", orderID)
+		}
+		if g.cancelled[orderID] {
+			return 0, fmt.Errorf("order (%v) was cancelled by its OCO group", orderID)
+		}
+		seen[orderID] = true
+	}
+
+	groupID := g.nextGroup
+	g.nextGroup++
+
+	g.groups[groupID] = append([]c.OrderID(nil), orderIDs...)
+	for _, orderID := range orderIDs {
+		g.members[orderID] = groupID
+	}
+	return groupID, nil
+}
+
+// GetSiblings returns the other orders of the order's group
+func (g *OCOGroups) GetSiblings(orderID c.OrderID) []c.OrderID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.siblings(orderID)
+}
+
+func (g *OCOGroups) siblings(orderID c.OrderID) []c.OrderID {
+	groupID, ok := g.members[orderID]
+	if !ok {
+		return nil
+	}
+
+	siblings := []c.OrderID{}
+	for _, member := range g.groups[groupID] {
+		if member != orderID {
+			siblings = append(siblings, member)
+		}
+	}
+	return siblings
+}
+
+// Filled dissolves the group of an order that traded and returns the siblings to cancel,
+// they are remembered as cancelled until they leave the chain
+func (g *OCOGroups) Filled(orderID c.OrderID) []c.OrderID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	siblings := g.siblings(orderID)
+	if siblings == nil {
+		return nil
+	}
+
+	delete(g.groups, g.members[orderID])
+	delete(g.members, orderID)
+	for _, sibling := range siblings {
+		delete(g.members, sibling)
+		g.cancelled[sibling] = true
+	}
+	return siblings
+}
+
+// Unlink takes the order out of its group, a group left with one order is dissolved
+func (g *OCOGroups) Unlink(orderID c.OrderID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.unlink(orderID)
+}
+
+func (g *OCOGroups) unlink(orderID c.OrderID) {
+	groupID, ok := g.members[orderID]
+	if !ok {
+		return
+	}
+
+	remaining := g.siblings(orderID)
+	delete(g.members, orderID)
+
+	if len(remaining) < 2 {
+		for _, member := range remaining {
+			delete(g.members, member)
+		}
+		delete(g.groups, groupID)
+		return
+	}
+	g.groups[groupID] = remaining
+}
+
+// IsCancelled reports whether a sibling fill cancelled the order
+func (g *OCOGroups) IsCancelled(orderID c.OrderID) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.cancelled[orderID]
+}
+
+// Sync forgets the orders that are no longer open on chain, a group that loses an order without
+// a fill, because its owner cancelled it, keeps linking the orders that are left
+func (g *OCOGroups) Sync(orders []ChainOrder) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	open := make(map[c.OrderID]bool, len(orders))
+	for _, order := range orders {
+		open[c.OrderID(order.OrderID)] = true
+	}
+
+	for orderID := range g.cancelled {
+		if !open[orderID] {
+			delete(g.cancelled, orderID)
+		}
+	}
+
+	gone := []c.OrderID{}
+	for orderID := range g.members {
+		if !open[orderID] {
+			gone = append(gone, orderID)
+		}
+	}
+	sort.Slice(gone, func(i, j int) bool { return gone[i] < gone[j] })
+	for _, orderID := range gone {
+		g.unlink(orderID)
+	}
+}
+
+// Exclude returns the orders that were not cancelled by a sibling
+func (g *OCOGroups) Exclude(orders []ChainOrder) []ChainOrder {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	live := make([]ChainOrder, 0, len(orders))
+	for _, order := range orders {
+		if !g.cancelled[c.OrderID(order.OrderID)] {
+			live = append(live, order)
+		}
+	}
+	return live
+}
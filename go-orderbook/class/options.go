@@ -0,0 +1,142 @@
+package class
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"orderbook.com/m/c"
+)
+
+// StopLimitOption makes the chain Stop order OrderID a stop-limit at LimitPrice, see SetStopLimit
+type StopLimitOption struct {
+	OrderID    uint64   `json:"orderId"`
+	LimitPrice *big.Int `json:"limitPrice"`
+}
+
+// TrailingOption makes the chain order OrderID a trailing order, see TrailingStops.Add
+type TrailingOption struct {
+	OrderID uint64 `json:"orderId"`
+	Trail   Trail  `json:"trail"`
+}
+
+// OrderOptions are the keeper behaviours DEX.Order has no field for, stop-limits, trailing orders
+// and OCO groups, registered by order ID in a JSON file the owners edit. The keeper reloads it on
+// every event and applies it to the orders of the snapshot, an option for an order that is not
+// open yet waits for it to show up. An OCO group is linked once all of its orders are open
+type OrderOptions struct {
+	StopLimits []StopLimitOption `json:"stopLimits,omitempty"`
+	Trailing   []TrailingOption  `json:"trailing,omitempty"`
+	OCO        [][]uint64        `json:"oco,omitempty"`
+}
+
+// LoadOrderOptions reads the options saved at path, a missing file holds no options
+func LoadOrderOptions(path string) (OrderOptions, error) {
+	var options OrderOptions
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return options, nil
+	}
+	if err != nil {
+		return options, err
+	}
+
+	if err := json.Unmarshal(data, &options); err != nil {
+		return options, fmt.Errorf("order options in %v: %w", path, err)
+	}
+	return options, nil
+}
+
+// Apply registers the options of every order in the snapshot, options already in place are
+// left alone. Every option that does not fit its order is reported in the error
+func (o OrderOptions) Apply(orders []ChainOrder, triggers *TriggerEngine, trailing *TrailingStops, oco *OCOGroups) error {
+	stopLimits := make(map[uint64]*big.Int, len(o.StopLimits))
+	for _, option := range o.StopLimits {
+		stopLimits[option.OrderID] = option.LimitPrice
+	}
+	trails := make(map[uint64]Trail, len(o.Trailing))
+	for _, option := range o.Trailing {
+		trails[option.OrderID] = option.Trail
+	}
+
+	var errs []error
+	for _, order := range orders {
+		if trail, ok := trails[order.OrderID]; ok {
+			// Add keeps the mark of an order that already trails, only a new trail is saved
+			if current, ok := trailing.GetTrailingStop(order.OrderID); !ok || !sameTrail(current.Trail, trail) {
+				if err := trailing.Add(order, trail); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+
+		limitPrice, ok := stopLimits[order.OrderID]
+		if !ok {
+			continue
+		}
+		if order.OrderType != ChainStop {
+			errs = append(errs, fmt.Errorf("order (%v) of chain type %v cannot be a stop-limit", order.OrderID, order.OrderType))
+			continue
+		}
+		if current, ok := triggers.GetStopLimit(order.OrderID); ok && limitPrice != nil && current.Cmp(limitPrice) == 0 {
+			continue
+		}
+		if err := triggers.SetStopLimit(order.OrderID, limitPrice); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	open := make(map[uint64]bool, len(orders))
+	for _, order := range orders {
+		open[order.OrderID] = true
+	}
+	for _, group := range o.OCO {
+		if err := linkOCO(oco, group, open); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// linkOCO links the group once every order of it is open. A group that is already linked is left
+// alone, and so is one that already fired: its filled order or its cancelled siblings are gone
+func linkOCO(oco *OCOGroups, group []uint64, open map[uint64]bool) error {
+	orderIDs := make([]c.OrderID, len(group))
+	for i, orderID := range group {
+		if !open[orderID] || oco.IsCancelled(c.OrderID(orderID)) {
+			return nil
+		}
+		orderIDs[i] = c.OrderID(orderID)
+	}
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	siblings := oco.GetSiblings(orderIDs[0])
+	if len(siblings) == len(orderIDs)-1 {
+		linked := make(map[c.OrderID]bool, len(siblings))
+		for _, sibling := range siblings {
+			linked[sibling] = true
+		}
+		same := true
+		for _, orderID := range orderIDs[1:] {
+			same = same && linked[orderID]
+		}
+		if same {
+			return nil
+		}
+	}
+
+	_, err := oco.Link(orderIDs...)
+	return err
+}
+
+func sameTrail(a, b Trail) bool {
+	if a.Bps != b.Bps || (a.Amount == nil) != (b.Amount == nil) {
+		return false
+	}
+	return a.Amount == nil || a.Amount.Cmp(b.Amount) == 0
+}
@@ -0,0 +1,204 @@
+package class
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"orderbook.com/m/c"
+)
+
+type Order struct {
+	orderType         c.OrderType
+	orderID           c.OrderID
+	side              c.Side
+	price             c.Price
+	initialQuantity   c.Quantity
+	remainingQuantity c.Quantity
+	expiry            time.Time
+	owner             string
+
+	// an iceberg shows displayQuantity at a time, visibleQuantity is what is left of that slice
+	displayQuantity c.Quantity
+	visibleQuantity c.Quantity
+
+	postOnly c.PostOnly
+
+	// position in the price level queue while the order rests in a SortedMap
+	level *skipNode
+	prev  *Order
+	next  *Order
+}
+
+// NewOrder creates and returns a new order with its full quantity remaining
+func NewOrder(orderType c.OrderType, orderID c.OrderID, side c.Side, price c.Price, quantity c.Quantity) *Order {
+	return &Order{
+		orderType:         orderType,
+		orderID:           orderID,
+		side:              side,
+		price:             price,
+		initialQuantity:   quantity,
+		remainingQuantity: quantity,
+	}
+}
+
+// NewGoodTillDateOrder creates an order that leaves the book at expiry
+func NewGoodTillDateOrder(orderID c.OrderID, side c.Side, price c.Price, quantity c.Quantity, expiry time.Time) *Order {
+	order := NewOrder(c.GoodTillDate, orderID, side, price, quantity)
+	order.expiry = expiry
+	return order
+}
+
+// NewIcebergOrder creates an order that only shows displayQuantity of its quantity, the rest
+// stays hidden and refreshes the visible slice each time it is filled
+func NewIcebergOrder(orderType c.OrderType, orderID c.OrderID, side c.Side, price c.Price, quantity, displayQuantity c.Quantity) *Order {
+	order := NewOrder(orderType, orderID, side, price, quantity)
+	order.setDisplayQuantity(displayQuantity)
+	return order
+}
+
+// NewMarketOrder creates a market order, its price stays NaN until it is converted with ToGoodTillCancel
+func NewMarketOrder(orderID c.OrderID, side c.Side, quantity c.Quantity) *Order {
+	return NewOrder(c.Market, orderID, side, c.Price(math.NaN()), quantity)
+}
+
+func (o *Order) GetOrderType() c.OrderType {
+	return o.orderType
+}
+
+func (o *Order) GetOrderID() c.OrderID {
+	return o.orderID
+}
+
+func (o *Order) GetSide() c.Side {
+	return o.side
+}
+
+func (o *Order) GetPrice() c.Price {
+	return o.price
+}
+
+func (o *Order) GetInitialQuantity() c.Quantity {
+	return o.initialQuantity
+}
+
+// GetRemainingQuantity returns everything left to fill, hidden quantity included
+func (o *Order) GetRemainingQuantity() c.Quantity {
+	return o.remainingQuantity
+}
+
+// GetDisplayQuantity returns the size of an iceberg's visible slice, zero for other orders
+func (o *Order) GetDisplayQuantity() c.Quantity {
+	return o.displayQuantity
+}
+
+// GetVisibleQuantity returns what the order shows in the book, the remaining quantity unless it
+// is an iceberg
+func (o *Order) GetVisibleQuantity() c.Quantity {
+	if !o.IsIceberg() {
+		return o.remainingQuantity
+	}
+	return o.visibleQuantity
+}
+
+func (o *Order) IsIceberg() bool {
+	return o.displayQuantity > 0
+}
+
+func (o *Order) setDisplayQuantity(displayQuantity c.Quantity) {
+	o.displayQuantity = displayQuantity
+	o.visibleQuantity = min(displayQuantity, o.remainingQuantity)
+}
+
+// canRefresh reports whether an iceberg used up its visible slice and has hidden quantity left
+func (o *Order) canRefresh() bool {
+	return o.IsIceberg() && o.visibleQuantity == 0 && o.remainingQuantity > 0
+}
+
+// refresh shows the next slice of an iceberg, the caller moves the order to the back of its level
+func (o *Order) refresh() {
+	o.visibleQuantity = min(o.displayQuantity, o.remainingQuantity)
+}
+
+// GetExpiry returns when the order leaves the book, zero for orders that never expire
+func (o *Order) GetExpiry() time.Time {
+	return o.expiry
+}
+
+func (o *Order) setExpiry(expiry time.Time) {
+	o.expiry = expiry
+}
+
+// GetOwner returns the wallet that placed the order, empty when unknown
+func (o *Order) GetOwner() string {
+	return o.owner
+}
+
+// SetOwner records the wallet that placed the order, self-trade prevention only applies to
+// orders with an owner
+func (o *Order) SetOwner(owner string) {
+	o.owner = owner
+}
+
+func (o *Order) GetPostOnly() c.PostOnly {
+	return o.postOnly
+}
+
+// SetPostOnly makes the order maker only, the book rejects or re-prices it when it would cross
+func (o *Order) SetPostOnly(postOnly c.PostOnly) {
+	o.postOnly = postOnly
+}
+
+func (o *Order) GetFilledQuantity() c.Quantity {
+	return o.initialQuantity - o.remainingQuantity
+}
+
+func (o *Order) IsFilled() bool {
+	return o.remainingQuantity == 0
+}
+
+// Fill reduces the remaining quantity, it never lets the order go below zero. An iceberg can only
+// be filled from its visible slice
+func (o *Order) Fill(quantity c.Quantity) error {
+	if quantity > o.remainingQuantity {
+		return fmt.Errorf("order (%v) cannot be filled for more than its remaining quantity", o.orderID)
+	}
+	if o.IsIceberg() && quantity > o.visibleQuantity {
+		return fmt.Errorf("order (%v) cannot be filled for more than its visible quantity", o.orderID)
+	}
+
+	o.remainingQuantity -= quantity
+	if o.IsIceberg() {
+		o.visibleQuantity -= quantity
+	}
+	if o.level != nil {
+		o.level.quantity -= quantity
+	}
+	return nil
+}
+
+// decreaseQuantity shrinks the remaining quantity in place, what was already filled is kept
+func (o *Order) decreaseQuantity(quantity c.Quantity) {
+	visible := o.GetVisibleQuantity()
+
+	o.initialQuantity -= o.remainingQuantity - quantity
+	o.remainingQuantity = quantity
+	if o.IsIceberg() {
+		o.visibleQuantity = min(o.visibleQuantity, quantity)
+	}
+
+	if o.level != nil {
+		o.level.quantity -= visible - o.GetVisibleQuantity()
+	}
+}
+
+// ToGoodTillCancel turns a market order into a limit order resting at the given price
+func (o *Order) ToGoodTillCancel(price c.Price) error {
+	if o.orderType != c.Market {
+		return fmt.Errorf("order (%v) cannot have its price adjusted, only market orders can", o.orderID)
+	}
+
+	o.price = price
+	o.orderType = c.GoodTillCancel
+	return nil
+}
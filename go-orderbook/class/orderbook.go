@@ -0,0 +1,473 @@
+package class
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"orderbook.com/m/c"
+)
+
+// Orderbook is an in-process limit order book matching in price-time priority.
+// Every exported method takes the book lock so the expiry pruner can run next to callers
+type Orderbook struct {
+	mu sync.Mutex
+
+	bids   *SortedMap
+	asks   *SortedMap
+	orders map[c.OrderID]*Order
+
+	clock         Clock
+	sessionCutoff time.Duration
+	expiries      expiryQueue
+	expired       []ExpiryEvent
+
+	fees          FeeSchedule
+	tradeSequence uint64
+
+	selfTrade c.SelfTradePrevention
+
+	oco *OCOGroups
+
+	tickSize c.Price
+
+	// version grows with every change of the resting orders, failed calls included
+	version uint64
+}
+
+// NewOrderbook creates an empty book, bids are kept best (highest) first and asks best (lowest) first
+func NewOrderbook() *Orderbook {
+	return &Orderbook{
+		bids:          NewSortedMap(true),
+		asks:          NewSortedMap(false),
+		orders:        make(map[c.OrderID]*Order),
+		clock:         SystemClock{},
+		sessionCutoff: DefaultSessionCutoff,
+	}
+}
+
+// GetBids returns a copy of the bids taken under the book lock, changing it leaves the book alone
+func (ob *Orderbook) GetBids() *SortedMap {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return ob.bids.clone()
+}
+
+// GetAsks returns a copy of the asks taken under the book lock, changing it leaves the book alone
+func (ob *Orderbook) GetAsks() *SortedMap {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return ob.asks.clone()
+}
+
+// GetOrder returns the resting order with this ID
+func (ob *Orderbook) GetOrder(orderID c.OrderID) (*Order, bool) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	order, ok := ob.orders[orderID]
+	return order, ok
+}
+
+// Size returns the number of resting orders
+func (ob *Orderbook) Size() int {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return len(ob.orders)
+}
+
+// GetVersion returns a counter that grows with every change of the resting orders. A call that
+// returns an error can still change the book, expired orders are pruned before any check
+func (ob *Orderbook) GetVersion() uint64 {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return ob.version
+}
+
+// GetLevelInfos returns the aggregated depth of both sides. Matching runs to completion inside
+// every AddOrder and ModifyOrder, so the snapshot never shows a crossed book, and the per level
+// totals are kept up to date on every change so it only costs O(depth) to build.
+// depth <= 0 returns every level and tickSize <= 0 disables price bucketing
+func (ob *Orderbook) GetLevelInfos(depth int, tickSize c.Price) OrderbookLevelInfos {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return NewOrderbookLevelInfos(ob.bids.levelInfos(depth, tickSize), ob.asks.levelInfos(depth, tickSize))
+}
+
+// AddOrder rests the order in the book and returns every trade it caused
+func (ob *Orderbook) AddOrder(order *Order) (Trades, error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return ob.addOrder(order)
+}
+
+func (ob *Orderbook) addOrder(order *Order) (Trades, error) {
+	// expired orders must never trade, drop them before matching
+	ob.expired = append(ob.expired, ob.pruneExpired(ob.clock.Now())...)
+
+	if _, ok := ob.orders[order.GetOrderID()]; ok {
+		return nil, fmt.Errorf("order (%v) already exists", order.GetOrderID())
+	}
+
+	if order.GetPostOnly() != c.PostOnlyOff {
+		if err := ob.applyPostOnly(order); err != nil {
+			return nil, err
+		}
+	}
+
+	// a market order becomes a limit at the worst opposite price so that it sweeps every level
+	if order.GetOrderType() == c.Market {
+		opposite := ob.opposite(order.GetSide())
+		if opposite.Empty() {
+			return nil, fmt.Errorf("order (%v) is a market order and there is no opposite liquidity", order.GetOrderID())
+		}
+
+		worstPrice, _ := opposite.RBegin()
+		if err := order.ToGoodTillCancel(worstPrice); err != nil {
+			return nil, err
+		}
+	}
+
+	switch order.GetOrderType() {
+	case c.GoodTillCancel:
+	case c.GoodTillDate:
+		if order.GetExpiry().IsZero() {
+			return nil, fmt.Errorf("order (%v) is GoodTillDate and has no expiry", order.GetOrderID())
+		}
+		if !order.GetExpiry().After(ob.clock.Now()) {
+			return nil, fmt.Errorf("order (%v) expired at %v", order.GetOrderID(), order.GetExpiry())
+		}
+	case c.GoodForDay:
+		// a replacement from ModifyOrder already carries the cutoff of the session it was placed in
+		if order.GetExpiry().IsZero() {
+			order.setExpiry(ob.nextSessionCutoff(ob.clock.Now()))
+		}
+	case c.FillAndKill:
+		if !ob.canMatch(order.GetSide(), order.GetPrice()) {
+			return nil, fmt.Errorf("order (%v) is FillAndKill and cannot be matched", order.GetOrderID())
+		}
+	case c.FillOrKill:
+		if !ob.canFullyFill(order.GetSide(), order.GetPrice(), order.GetRemainingQuantity(), order) {
+			return nil, fmt.Errorf("order (%v) is FillOrKill and cannot be fully filled", order.GetOrderID())
+		}
+	default:
+		return nil, fmt.Errorf("order (%v) has unsupported order type %v", order.GetOrderID(), order.GetOrderType())
+	}
+
+	ob.side(order.GetSide()).AddData(order.GetPrice(), order)
+	ob.orders[order.GetOrderID()] = order
+	ob.version++
+	if !order.GetExpiry().IsZero() {
+		ob.expiries.push(order)
+	}
+
+	trades := ob.matchOrders(order.GetSide())
+
+	// FillAndKill never rests, whatever is left after matching is cancelled. Neither does
+	// FillOrKill, canFullyFill walks the book like matching does so this is only a safety net
+	kills := order.GetOrderType() == c.FillAndKill || order.GetOrderType() == c.FillOrKill
+	if kills && !order.IsFilled() {
+		ob.cancelOrder(order.GetOrderID())
+	}
+
+	return trades, nil
+}
+
+// CancelOrder removes a resting order from its price level
+func (ob *Orderbook) CancelOrder(orderID c.OrderID) error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return ob.cancelOrder(orderID)
+}
+
+func (ob *Orderbook) cancelOrder(orderID c.OrderID) error {
+	order, ok := ob.orders[orderID]
+	if !ok {
+		return fmt.Errorf("order (%v) does not exist", orderID)
+	}
+
+	ob.removeOrder(order)
+	ob.version++
+	return nil
+}
+
+// removeOrder takes the order out of the book without counting it as a change
+func (ob *Orderbook) removeOrder(order *Order) {
+	ob.side(order.GetSide()).RemoveOrder(order)
+	delete(ob.orders, order.GetOrderID())
+}
+
+// ModifyOrder replaces a resting order. Shrinking the size at the same price and side keeps
+// its place in the queue, any other change cancels it and re-adds it at the back of the queue.
+// A replacement the book rejects leaves the original where it was
+func (ob *Orderbook) ModifyOrder(orderID c.OrderID, side c.Side, price c.Price, quantity c.Quantity) (Trades, error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	// an order that expired is gone, it cannot come back through a modify
+	ob.expired = append(ob.expired, ob.pruneExpired(ob.clock.Now())...)
+
+	order, ok := ob.orders[orderID]
+	if !ok {
+		return nil, fmt.Errorf("order (%v) does not exist", orderID)
+	}
+
+	if quantity == 0 {
+		return nil, fmt.Errorf("order (%v) cannot be modified to a zero quantity, cancel it instead", orderID)
+	}
+
+	if side == order.GetSide() && price == order.GetPrice() && quantity <= order.GetRemainingQuantity() {
+		order.decreaseQuantity(quantity)
+		ob.version++
+		return Trades{}, nil
+	}
+
+	// the replacement keeps the expiry of the original so GoodForDay is not pushed to the next session
+	replacement := NewOrder(order.GetOrderType(), orderID, side, price, quantity)
+	replacement.setExpiry(order.GetExpiry())
+	replacement.SetOwner(order.GetOwner())
+	replacement.setDisplayQuantity(order.GetDisplayQuantity())
+	replacement.SetPostOnly(order.GetPostOnly())
+
+	// the original only counts as cancelled once the replacement is in
+	next := order.next
+	ob.removeOrder(order)
+
+	trades, err := ob.addOrder(replacement)
+	if err != nil {
+		ob.side(order.GetSide()).restore(order, next)
+		ob.orders[orderID] = order
+		// the prune inside addOrder may have popped it while it was out of the book
+		if !order.GetExpiry().IsZero() {
+			ob.expiries.push(order)
+		}
+		return nil, err
+	}
+	return trades, nil
+}
+
+// CanMatch reports whether an order at this price would cross the opposite side
+func (ob *Orderbook) CanMatch(side c.Side, price c.Price) bool {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return ob.canMatch(side, price)
+}
+
+func (ob *Orderbook) canMatch(side c.Side, price c.Price) bool {
+	if side == c.BUY {
+		if ob.asks.Empty() {
+			return false
+		}
+		return price >= ob.asks.BestPrice()
+	}
+
+	if ob.bids.Empty() {
+		return false
+	}
+	return price <= ob.bids.BestPrice()
+}
+
+// CanFullyFill reports whether the opposite side holds enough quantity at or better than price
+func (ob *Orderbook) CanFullyFill(side c.Side, price c.Price, quantity c.Quantity) bool {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return ob.canFullyFill(side, price, quantity, nil)
+}
+
+// canFullyFill walks the opposite side like matching would. Orders of the same owner as the
+// taker are not liquidity under self-trade prevention, with CancelOldest they are skipped and with
+// any other mode reaching one would stop the incoming order before it is filled. An OCO sibling
+// of the taker or of an order the walk already traded against is cancelled by that fill, so it
+// is skipped too
+func (ob *Orderbook) canFullyFill(side c.Side, price c.Price, quantity c.Quantity, taker *Order) bool {
+	if !ob.canMatch(side, price) {
+		return false
+	}
+
+	owner := ""
+	cancelled := make(map[c.OrderID]bool)
+	cancelSiblings := func(orderID c.OrderID) {
+		if ob.oco == nil {
+			return
+		}
+		for _, sibling := range ob.oco.GetSiblings(orderID) {
+			cancelled[sibling] = true
+		}
+	}
+	if taker != nil {
+		owner = taker.GetOwner()
+		cancelSiblings(taker.GetOrderID())
+	}
+
+	for node := ob.opposite(side).levels.first(); node != nil; node = node.next[0] {
+		if (side == c.BUY && node.price > price) || (side == c.SELL && node.price < price) {
+			break
+		}
+
+		for order := node.head; order != nil; order = order.next {
+			if cancelled[order.GetOrderID()] {
+				continue
+			}
+			if ob.isSelfTrade(owner, order.GetOwner()) {
+				if ob.selfTrade == c.CancelOldest {
+					continue
+				}
+				return false
+			}
+
+			if order.GetRemainingQuantity() >= quantity {
+				return true
+			}
+			quantity -= order.GetRemainingQuantity()
+			cancelSiblings(order.GetOrderID())
+		}
+	}
+	return false
+}
+
+func (ob *Orderbook) side(side c.Side) *SortedMap {
+	if side == c.BUY {
+		return ob.bids
+	}
+	return ob.asks
+}
+
+func (ob *Orderbook) opposite(side c.Side) *SortedMap {
+	if side == c.BUY {
+		return ob.asks
+	}
+	return ob.bids
+}
+
+// matchOrders keeps crossing the best bid with the best ask until the book is no longer crossed.
+// The book is never crossed before an order comes in, so the incoming order is always the taker
+func (ob *Orderbook) matchOrders(takerSide c.Side) Trades {
+	trades := Trades{}
+	now := ob.clock.Now()
+
+	for !ob.bids.Empty() && !ob.asks.Empty() {
+		bid := ob.bids.Front()
+		ask := ob.asks.Front()
+
+		if bid.GetPrice() < ask.GetPrice() {
+			break
+		}
+
+		if ob.isSelfTrade(bid.GetOwner(), ask.GetOwner()) {
+			ob.preventSelfTrade(bid, ask, takerSide)
+			continue
+		}
+
+		quantity := min(bid.GetVisibleQuantity(), ask.GetVisibleQuantity())
+
+		// quantity never exceeds either visible quantity so Fill cannot fail here
+		bid.Fill(quantity)
+		ask.Fill(quantity)
+
+		// a filled iceberg slice is replaced from the reserve and loses its time priority
+		if bid.IsFilled() {
+			ob.bids.RemoveOrder(bid)
+			delete(ob.orders, bid.GetOrderID())
+		} else {
+			ob.bids.refreshIceberg(bid)
+		}
+		if ask.IsFilled() {
+			ob.asks.RemoveOrder(ask)
+			delete(ob.orders, ask.GetOrderID())
+		} else {
+			ob.asks.refreshIceberg(ask)
+		}
+
+		// a fill of an OCO order cancels the siblings resting here before they can trade
+		ob.cancelSiblings(bid.GetOrderID())
+		ob.cancelSiblings(ask.GetOrderID())
+
+		trade := NewTrade(
+			TradeInfo{OrderId: bid.GetOrderID(), Price: bid.GetPrice(), Quantity: quantity},
+			TradeInfo{OrderId: ask.GetOrderID(), Price: ask.GetPrice(), Quantity: quantity},
+		)
+
+		trade.price = ask.GetPrice()
+		if takerSide == c.SELL {
+			trade.price = bid.GetPrice()
+		}
+		ob.tradeSequence++
+		trade.quantity = quantity
+		trade.takerSide = takerSide
+		trade.sequence = ob.tradeSequence
+		trade.timestamp = now
+		trade.makerFee, trade.takerFee = ob.fees.fees(trade.GetNotional())
+
+		trades = append(trades, trade)
+	}
+
+	return trades
+}
+
+// SetOCOGroups links the book to OCO groups, they may be shared with other books but not with the
+// keeper since a fill in the book never reaches the chain
+func (ob *Orderbook) SetOCOGroups(groups *OCOGroups) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ob.oco = groups
+}
+
+func (ob *Orderbook) cancelSiblings(orderID c.OrderID) {
+	if ob.oco == nil {
+		return
+	}
+	for _, sibling := range ob.oco.Filled(orderID) {
+		if _, ok := ob.orders[sibling]; ok {
+			ob.cancelOrder(sibling)
+		}
+	}
+}
+
+// SetSelfTradePrevention changes how orders of the same owner are kept from matching
+func (ob *Orderbook) SetSelfTradePrevention(mode c.SelfTradePrevention) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ob.selfTrade = mode
+}
+
+func (ob *Orderbook) isSelfTrade(owner, otherOwner string) bool {
+	return ob.selfTrade != c.AllowSelfTrade && owner != "" && owner == otherOwner
+}
+
+// preventSelfTrade resolves a crossing pair of the same owner without trading
+func (ob *Orderbook) preventSelfTrade(bid, ask *Order, takerSide c.Side) {
+	taker, maker := bid, ask
+	if takerSide == c.SELL {
+		taker, maker = ask, bid
+	}
+
+	switch ob.selfTrade {
+	case c.CancelNewest:
+		ob.cancelOrder(taker.GetOrderID())
+	case c.CancelOldest:
+		ob.cancelOrder(maker.GetOrderID())
+	case c.CancelBoth:
+		ob.cancelOrder(taker.GetOrderID())
+		ob.cancelOrder(maker.GetOrderID())
+	case c.DecrementAndCancel:
+		quantity := min(taker.GetRemainingQuantity(), maker.GetRemainingQuantity())
+		for _, order := range []*Order{taker, maker} {
+			if order.GetRemainingQuantity() == quantity {
+				ob.cancelOrder(order.GetOrderID())
+			} else {
+				order.decreaseQuantity(order.GetRemainingQuantity() - quantity)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package class
+
+import (
+	"errors"
+	"fmt"
+
+	"orderbook.com/m/c"
+)
+
+// ErrPostOnlyWouldCross is wrapped by every rejection of a post-only order, the message gives the
+// reason and the price it would have taken
+var ErrPostOnlyWouldCross = errors.New("post-only order would take liquidity")
+
+// SetTickSize sets the price increment post-only orders slide by
+func (ob *Orderbook) SetTickSize(tickSize c.Price) error {
+	if tickSize <= 0 {
+		return fmt.Errorf("tick size (%v) must be positive", tickSize)
+	}
+
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ob.tickSize = tickSize
+	return nil
+}
+
+func (ob *Orderbook) GetTickSize() c.Price {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	return ob.tickSize
+}
+
+// applyPostOnly makes sure a post-only order rests without trading. A crossing order is rejected,
+// or with PostOnlySlide re-priced one tick behind the opposite best price
+func (ob *Orderbook) applyPostOnly(order *Order) error {
+	switch order.GetOrderType() {
+	case c.Market, c.FillAndKill, c.FillOrKill:
+		return fmt.Errorf("order (%v) is %v and always takes liquidity: %w", order.GetOrderID(), order.GetOrderType(), ErrPostOnlyWouldCross)
+	}
+
+	if !ob.canMatch(order.GetSide(), order.GetPrice()) {
+		return nil
+	}
+
+	bestPrice := ob.opposite(order.GetSide()).BestPrice()
+	if order.GetPostOnly() != c.PostOnlySlide {
+		return fmt.Errorf("order (%v) at %v would cross the best %v at %v: %w", order.GetOrderID(), order.GetPrice(), oppositeName(order.GetSide()), bestPrice, ErrPostOnlyWouldCross)
+	}
+	if ob.tickSize <= 0 {
+		return fmt.Errorf("order (%v) cannot slide without a tick size: %w", order.GetOrderID(), ErrPostOnlyWouldCross)
+	}
+
+	price := bestPrice + ob.tickSize
+	if order.GetSide() == c.BUY {
+		price = bestPrice - ob.tickSize
+	}
+	if price <= 0 {
+		return fmt.Errorf("order (%v) cannot slide below the best %v at %v: %w", order.GetOrderID(), oppositeName(order.GetSide()), bestPrice, ErrPostOnlyWouldCross)
+	}
+
+	order.price = price
+	return nil
+}
+
+func oppositeName(side c.Side) string {
+	if side == c.BUY {
+		return "ask"
+	}
+	return "bid"
+}
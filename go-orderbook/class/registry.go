@@ -0,0 +1,329 @@
+package class
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"orderbook.com/m/c"
+	"orderbook.com/m/fixed"
+)
+
+// Chain order types, they match the DEX.OrderType enum
+const (
+	ChainMarket uint8 = iota
+	ChainLimit
+	ChainStop
+)
+
+// ChainOrder mirrors the DEX.Order struct returned by getAllOrders. The order sells Quantity of
+// TokenPair0 for TokenPair1 at Price, the amount of TokenPair1 per TokenPair0 scaled by 1e18
+type ChainOrder struct {
+	UserAddress common.Address // Matches Solidity's `address`
+	OrderType   uint8          // Matches Solidity's `uint8` enum for `OrderType`
+	OrderID     uint64         // Matches Solidity's `uint64`
+	Price       *big.Int       // Matches Solidity's `uint256`
+	Quantity    *big.Int       // Matches Solidity's `uint256`
+	TokenPair0  common.Address // Matches Solidity's `address`
+	TokenPair1  common.Address // Matches Solidity's `address`
+}
+
+// TokenPair is a market ordered the way MasterLiquidityPool sorts tokens, Base is the lower
+// address and prices in its book are Quote per Base
+type TokenPair struct {
+	Base  common.Address
+	Quote common.Address
+}
+
+func NewTokenPair(tokenA, tokenB common.Address) TokenPair {
+	if bytes.Compare(tokenA.Bytes(), tokenB.Bytes()) < 0 {
+		return TokenPair{Base: tokenA, Quote: tokenB}
+	}
+	return TokenPair{Base: tokenB, Quote: tokenA}
+}
+
+func (p TokenPair) String() string {
+	return p.Base.Hex() + "/" + p.Quote.Hex()
+}
+
+// DefaultQuantityScale converts on-chain amounts (18 decimals) into book quantities of 1e-9 tokens
+var DefaultQuantityScale = big.NewInt(1e9)
+
+// OrderbookRegistry keeps one Orderbook per token pair and routes chain orders to it
+type OrderbookRegistry struct {
+	mu sync.Mutex
+
+	books         map[TokenPair]*Orderbook
+	orders        map[c.OrderID]TokenPair
+	quantityScale *big.Int
+	oco           *OCOGroups
+
+	// chain quantities of the resting orders, and of the orders the books filled off-chain. A
+	// matched order stays open on chain, Sync skips it until its chain quantity changes
+	quantities map[c.OrderID]*big.Int
+	matched    map[c.OrderID]*big.Int
+}
+
+func NewOrderbookRegistry() *OrderbookRegistry {
+	return &OrderbookRegistry{
+		books:         make(map[TokenPair]*Orderbook),
+		orders:        make(map[c.OrderID]TokenPair),
+		quantityScale: DefaultQuantityScale,
+		quantities:    make(map[c.OrderID]*big.Int),
+		matched:       make(map[c.OrderID]*big.Int),
+	}
+}
+
+// GetOrderbook returns the book of the pair, creating it the first time the pair is seen
+func (r *OrderbookRegistry) GetOrderbook(tokenA, tokenB common.Address) *Orderbook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.orderbook(NewTokenPair(tokenA, tokenB))
+}
+
+func (r *OrderbookRegistry) orderbook(pair TokenPair) *Orderbook {
+	book, ok := r.books[pair]
+	if !ok {
+		book = NewOrderbook()
+		book.SetOCOGroups(r.oco)
+		r.books[pair] = book
+	}
+	return book
+}
+
+// SetOCOGroups links every book, current and future, to the OCO groups. The books trade off-chain,
+// so the groups must be their own and not the keeper's
+func (r *OrderbookRegistry) SetOCOGroups(groups *OCOGroups) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.oco = groups
+	for _, book := range r.books {
+		book.SetOCOGroups(groups)
+	}
+}
+
+// GetPairs returns every pair with a book, sorted by base then quote address
+func (r *OrderbookRegistry) GetPairs() []TokenPair {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pairs := make([]TokenPair, 0, len(r.books))
+	for pair := range r.books {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if cmp := bytes.Compare(pairs[i].Base.Bytes(), pairs[j].Base.Bytes()); cmp != 0 {
+			return cmp < 0
+		}
+		return bytes.Compare(pairs[i].Quote.Bytes(), pairs[j].Quote.Bytes()) < 0
+	})
+	return pairs
+}
+
+// ToEngineOrder converts a chain order into an order of its pair's book. Selling the base is a
+// SELL at Price, selling the quote is a BUY at 1/Price for the base amount the quote buys.
+// Stop orders only become liquidity once triggered so they cannot be converted
+func (r *OrderbookRegistry) ToEngineOrder(order ChainOrder) (*Order, TokenPair, error) {
+	pair := NewTokenPair(order.TokenPair0, order.TokenPair1)
+
+	if order.TokenPair0 == order.TokenPair1 {
+		return nil, pair, fmt.Errorf("order (%v) trades a token against itself", order.OrderID)
+	}
+	if order.Price == nil || order.Price.Sign() <= 0 {
+		return nil, pair, fmt.Errorf("order (%v) has no positive price", order.OrderID)
+	}
+	if order.Quantity == nil || order.Quantity.Sign() <= 0 {
+		return nil, pair, fmt.Errorf("order (%v) has no positive quantity", order.OrderID)
+	}
+
+	var orderType c.OrderType
+	switch order.OrderType {
+	case ChainMarket:
+		orderType = c.Market
+	case ChainLimit:
+		orderType = c.GoodTillCancel
+	default:
+		return nil, pair, fmt.Errorf("order (%v) of chain type %v is not book liquidity", order.OrderID, order.OrderType)
+	}
+
+	chainPrice, err := fixed.New(order.Price)
+	if err != nil {
+		return nil, pair, fmt.Errorf("order (%v) price: %w", order.OrderID, err)
+	}
+
+	price := chainPrice.Float64()
+	baseAmount := new(big.Int).Set(order.Quantity)
+	side := c.SELL
+
+	// the quote it sells pays out _multiply(price, quantity) of the base on chain
+	if order.TokenPair0 == pair.Quote {
+		side = c.BUY
+		price = 1 / price
+		baseAmount, err = fixed.Mul(order.Quantity, order.Price, fixed.Floor)
+		if err != nil {
+			return nil, pair, fmt.Errorf("order (%v) quantity: %w", order.OrderID, err)
+		}
+	}
+
+	quantity := new(big.Int).Div(baseAmount, r.quantityScale)
+	if !quantity.IsUint64() || quantity.Sign() == 0 {
+		return nil, pair, fmt.Errorf("order (%v) quantity %v does not fit the book", order.OrderID, baseAmount)
+	}
+
+	var engineOrder *Order
+	if orderType == c.Market {
+		engineOrder = NewMarketOrder(c.OrderID(order.OrderID), side, c.Quantity(quantity.Uint64()))
+	} else {
+		engineOrder = NewOrder(orderType, c.OrderID(order.OrderID), side, c.Price(price), c.Quantity(quantity.Uint64()))
+	}
+	engineOrder.SetOwner(order.UserAddress.Hex())
+
+	return engineOrder, pair, nil
+}
+
+// AddChainOrder converts the order and adds it to its pair's book
+func (r *OrderbookRegistry) AddChainOrder(order ChainOrder) (Trades, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.addChainOrder(order)
+}
+
+func (r *OrderbookRegistry) addChainOrder(order ChainOrder) (Trades, error) {
+	engineOrder, pair, err := r.ToEngineOrder(order)
+	if err != nil {
+		return nil, err
+	}
+
+	book := r.orderbook(pair)
+	trades, err := book.AddOrder(engineOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	r.quantities[engineOrder.GetOrderID()] = order.Quantity
+	if _, resting := book.GetOrder(engineOrder.GetOrderID()); resting {
+		r.orders[engineOrder.GetOrderID()] = pair
+	} else if len(trades) == 0 {
+		delete(r.quantities, engineOrder.GetOrderID())
+	}
+	r.forgetFilled(book, trades)
+	return trades, nil
+}
+
+// CancelOrder removes the order from whichever book holds it
+func (r *OrderbookRegistry) CancelOrder(orderID uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cancelOrder(c.OrderID(orderID))
+}
+
+func (r *OrderbookRegistry) cancelOrder(orderID c.OrderID) error {
+	pair, ok := r.orders[orderID]
+	if !ok {
+		return fmt.Errorf("order (%v) is not in any book", orderID)
+	}
+
+	delete(r.orders, orderID)
+	delete(r.quantities, orderID)
+	return r.books[pair].CancelOrder(orderID)
+}
+
+// Sync brings the books in line with a getAllOrders snapshot: new orders are added, orders that
+// shrank on chain are reduced in place and orders missing from the snapshot are cancelled.
+// Orders the books already filled are only added again once their chain quantity changes.
+// Stop orders are skipped, every other order that cannot be converted is reported in the error
+func (r *OrderbookRegistry) Sync(orders []ChainOrder) (map[TokenPair]Trades, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	trades := make(map[TokenPair]Trades)
+	seen := make(map[c.OrderID]bool, len(orders))
+	var errs []error
+
+	for _, order := range orders {
+		if order.OrderType == ChainStop {
+			continue
+		}
+		seen[c.OrderID(order.OrderID)] = true
+
+		if quantity, ok := r.matched[c.OrderID(order.OrderID)]; ok {
+			if order.Quantity != nil && order.Quantity.Cmp(quantity) == 0 {
+				continue
+			}
+			delete(r.matched, c.OrderID(order.OrderID))
+		}
+
+		if pair, ok := r.orders[c.OrderID(order.OrderID)]; ok {
+			if err := r.syncQuantity(pair, order); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		orderTrades, err := r.addChainOrder(order)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(orderTrades) > 0 {
+			pair := NewTokenPair(order.TokenPair0, order.TokenPair1)
+			trades[pair] = append(trades[pair], orderTrades...)
+		}
+	}
+
+	for orderID := range r.orders {
+		if !seen[orderID] {
+			r.cancelOrder(orderID)
+		}
+	}
+	for orderID := range r.matched {
+		if !seen[orderID] {
+			delete(r.matched, orderID)
+		}
+	}
+
+	return trades, errors.Join(errs...)
+}
+
+// syncQuantity reduces a resting order that was partly executed on chain
+func (r *OrderbookRegistry) syncQuantity(pair TokenPair, order ChainOrder) error {
+	engineOrder, _, err := r.ToEngineOrder(order)
+	if err != nil {
+		return err
+	}
+	r.quantities[engineOrder.GetOrderID()] = order.Quantity
+
+	book := r.books[pair]
+	resting, ok := book.GetOrder(engineOrder.GetOrderID())
+	if !ok || engineOrder.GetRemainingQuantity() >= resting.GetRemainingQuantity() {
+		return nil
+	}
+
+	_, err = book.ModifyOrder(resting.GetOrderID(), resting.GetSide(), resting.GetPrice(), engineOrder.GetRemainingQuantity())
+	return err
+}
+
+// forgetFilled drops the orders a batch of trades filled completely and remembers the chain
+// quantity they were filled at
+func (r *OrderbookRegistry) forgetFilled(book *Orderbook, trades Trades) {
+	for _, trade := range trades {
+		for _, orderID := range []c.OrderID{trade.GetBidTrade().OrderId, trade.GetAskTrade().OrderId} {
+			if _, resting := book.GetOrder(orderID); resting {
+				continue
+			}
+			delete(r.orders, orderID)
+			if quantity, ok := r.quantities[orderID]; ok {
+				r.matched[orderID] = quantity
+				delete(r.quantities, orderID)
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package class
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"orderbook.com/m/fixed"
+)
+
+// RingFill is a ring trade ready for DEX.matchTrade. matchTrade only accepts a list where every
+// order buys what the next one sells, so orders of the same leg cannot follow each other: the
+// list goes around the ring once per lap, taking the next order of a leg once its best one is
+// used up. An order spread over several laps appears once per lap, its quantities never add up
+// to more than it holds
+type RingFill struct {
+	Orders     []ChainOrder
+	Quantities []*big.Int
+	Laps       int
+}
+
+// GetOrderIDs returns the order list of matchTrade
+func (f RingFill) GetOrderIDs() []uint64 {
+	orderIDs := make([]uint64, len(f.Orders))
+	for i, order := range f.Orders {
+		orderIDs[i] = order.OrderID
+	}
+	return orderIDs
+}
+
+// ringLap is one pass around the ring, an order and a quantity per leg
+type ringLap struct {
+	orders     []ChainOrder
+	quantities []*big.Int
+}
+
+// closing returns what the last order of the lap is paid, the first order of the next lap has to
+// deliver at least as much
+func (l ringLap) closing() (*big.Int, error) {
+	last := len(l.orders) - 1
+	return fixed.Mul(l.quantities[last], l.orders[last].Price, fixed.Floor)
+}
+
+// FillRing matches the queues of a ring's legs in price priority, the lowest price first and the
+// older order on a tie. Laps are added while their prices still leave a surplus and each lap is as
+// large as the orders it uses allow. matchTrade checks every order against the next one, also
+// across laps, so laps are listed from the smallest to the largest and the smallest are left out
+// when they cannot pay for the largest, they are matched by a later batch
+func FillRing(legs [][]ChainOrder) (RingFill, error) {
+	if len(legs) < 2 {
+		return RingFill{}, fmt.Errorf("a ring needs at least two legs, got %v", len(legs))
+	}
+
+	queues := make([][]ChainOrder, len(legs))
+	remaining := make(map[uint64]*big.Int)
+	for i, leg := range legs {
+		next := legs[(i+1)%len(legs)]
+		for _, order := range leg {
+			if len(next) > 0 && order.TokenPair1 != next[0].TokenPair0 {
+				return RingFill{}, fmt.Errorf("order (%v) buys %v but leg %v sells %v", order.OrderID, order.TokenPair1.Hex(), (i+1)%len(legs), next[0].TokenPair0.Hex())
+			}
+			if _, ok := remaining[order.OrderID]; ok {
+				return RingFill{}, fmt.Errorf("order (%v) is queued twice", order.OrderID)
+			}
+			remaining[order.OrderID] = new(big.Int).Set(order.Quantity)
+		}
+
+		queues[i] = append([]ChainOrder(nil), leg...)
+		sort.SliceStable(queues[i], func(a, b int) bool {
+			if cmp := queues[i][a].Price.Cmp(queues[i][b].Price); cmp != 0 {
+				return cmp < 0
+			}
+			return queues[i][a].OrderID < queues[i][b].OrderID
+		})
+	}
+
+	heads := make([]int, len(queues))
+	laps := []ringLap{}
+	for {
+		lap := ringLap{orders: make([]ChainOrder, len(queues))}
+		prices := make([]*big.Int, len(queues))
+		exhausted := false
+		for i, queue := range queues {
+			if heads[i] >= len(queue) {
+				exhausted = true
+				break
+			}
+			lap.orders[i] = queue[heads[i]]
+			prices[i] = lap.orders[i].Price
+		}
+		if exhausted {
+			break
+		}
+
+		score, err := ScoreCycle(prices)
+		if err != nil {
+			return RingFill{}, err
+		}
+		if score.Sign() < 0 {
+			break
+		}
+
+		lap.quantities, err = lapQuantities(lap.orders, remaining)
+		if err != nil {
+			return RingFill{}, err
+		}
+		if !allPositive(lap.quantities) {
+			break
+		}
+		laps = append(laps, lap)
+
+		advanced := false
+		for i, order := range lap.orders {
+			left := remaining[order.OrderID]
+			left.Sub(left, lap.quantities[i])
+			if left.Sign() == 0 {
+				heads[i]++
+				advanced = true
+			}
+		}
+		// the same orders would only give a smaller lap out of what rounding left
+		if !advanced {
+			break
+		}
+	}
+
+	sort.SliceStable(laps, func(a, b int) bool { return laps[a].quantities[0].Cmp(laps[b].quantities[0]) < 0 })
+	for len(laps) > 1 {
+		closing, err := laps[len(laps)-1].closing()
+		if err != nil {
+			return RingFill{}, err
+		}
+		if laps[0].quantities[0].Cmp(closing) >= 0 {
+			break
+		}
+		laps = laps[1:]
+	}
+
+	fill := RingFill{Laps: len(laps)}
+	for _, lap := range laps {
+		fill.Orders = append(fill.Orders, lap.orders...)
+		fill.Quantities = append(fill.Quantities, lap.quantities...)
+	}
+	return fill, nil
+}
+
+// lapQuantities returns the largest quantities the orders can trade in one lap. Every order is
+// paid exactly what the next one delivers, rounded down like DEX._multiply, so the lap is bounded
+// backwards from the last leg and then filled forwards from the first
+func lapQuantities(orders []ChainOrder, remaining map[uint64]*big.Int) ([]*big.Int, error) {
+	last := len(orders) - 1
+
+	bound := new(big.Int).Set(remaining[orders[last].OrderID])
+	for i := last - 1; i >= 0; i-- {
+		limit := new(big.Int).Set(remaining[orders[i].OrderID])
+		if orders[i].Price.Sign() > 0 {
+			affordable, err := fixed.Div(bound, orders[i].Price, fixed.Floor)
+			if err != nil {
+				return nil, fmt.Errorf("order (%v): %w", orders[i].OrderID, err)
+			}
+			if affordable.Cmp(limit) < 0 {
+				limit = affordable
+			}
+		}
+		bound = limit
+	}
+
+	quantities := make([]*big.Int, len(orders))
+	quantities[0] = bound
+	for i := 0; i < last; i++ {
+		next, err := fixed.Mul(quantities[i], orders[i].Price, fixed.Floor)
+		if err != nil {
+			return nil, fmt.Errorf("order (%v): %w", orders[i].OrderID, err)
+		}
+		quantities[i+1] = next
+	}
+	return quantities, nil
+}
+
+func allPositive(quantities []*big.Int) bool {
+	for _, quantity := range quantities {
+		if quantity.Sign() <= 0 {
+			return false
+		}
+	}
+	return true
+}
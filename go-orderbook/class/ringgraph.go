@@ -0,0 +1,321 @@
+package class
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"orderbook.com/m/c"
+)
+
+// DefaultMaxCycleLength bounds the rings a RingGraph looks for, every leg adds to the gas of matchTrade
+const DefaultMaxCycleLength = 6
+
+// ScoredCycle is a ring of tokens with the ScoreCycle score of the orders on its legs
+type ScoredCycle struct {
+	Path  []string
+	Score *big.Int
+}
+
+// RingGraph queues the open chain orders of every directed pair, keyed by token address, the
+// lowest price first and the older order on a tie. Clear matches rings out of the queues until
+// none leaves a surplus, taking what every batch trades off the queues
+type RingGraph struct {
+	queues         map[string]map[string][]ChainOrder
+	selfTrade      c.SelfTradePrevention
+	maxCycleLength int
+	oco            *OCOGroups
+}
+
+func NewRingGraph() *RingGraph {
+	return &RingGraph{
+		queues:         make(map[string]map[string][]ChainOrder),
+		maxCycleLength: DefaultMaxCycleLength,
+	}
+}
+
+// AddOrder queues the order on its TokenPair0 -> TokenPair1 leg
+func (g *RingGraph) AddOrder(order ChainOrder) {
+	from, to := order.TokenPair0.Hex(), order.TokenPair1.Hex()
+	if g.queues[from] == nil {
+		g.queues[from] = make(map[string][]ChainOrder)
+	}
+
+	queue := append(g.queues[from][to], order)
+	sort.SliceStable(queue, func(i, j int) bool {
+		if cmp := queue[i].Price.Cmp(queue[j].Price); cmp != 0 {
+			return cmp < 0
+		}
+		return queue[i].OrderID < queue[j].OrderID
+	})
+	g.queues[from][to] = queue
+}
+
+// GetQueue returns the orders left on the tokenIn -> tokenOut leg, best price first
+func (g *RingGraph) GetQueue(tokenIn, tokenOut common.Address) []ChainOrder {
+	return g.queues[tokenIn.Hex()][tokenOut.Hex()]
+}
+
+// SetSelfTradePrevention changes how rings holding several orders of the same wallet are resolved
+func (g *RingGraph) SetSelfTradePrevention(mode c.SelfTradePrevention) {
+	g.selfTrade = mode
+}
+
+// SetMaxCycleLength bounds the number of legs of a ring, zero or less removes the bound
+func (g *RingGraph) SetMaxCycleLength(maxLength int) {
+	g.maxCycleLength = maxLength
+}
+
+// SetOCOGroups lets Clear drop the siblings of every order it matched. The groups are only read,
+// they can be the keeper's
+func (g *RingGraph) SetOCOGroups(groups *OCOGroups) {
+	g.oco = groups
+}
+
+// Cycles enumerates every ring of the graph up to the maximum length, scored with the first order
+// of each leg and sorted best first. Equal scores prefer the shorter ring, then the lower path
+func (g *RingGraph) Cycles() []ScoredCycle {
+	adjacency := make(map[string][]string, len(g.queues))
+	for from, tos := range g.queues {
+		for to := range tos {
+			adjacency[from] = append(adjacency[from], to)
+		}
+	}
+
+	cycles := []ScoredCycle{}
+	for _, path := range ElementaryCycles(adjacency, g.maxCycleLength) {
+		score, err := ScoreCycle(g.headPrices(path))
+		// a ring whose prices overflow the product cannot be matched either
+		if err != nil {
+			continue
+		}
+		cycles = append(cycles, ScoredCycle{Path: path, Score: score})
+	}
+
+	sort.SliceStable(cycles, func(i, j int) bool {
+		if cmp := cycles[i].Score.Cmp(cycles[j].Score); cmp != 0 {
+			return cmp > 0
+		}
+		if len(cycles[i].Path) != len(cycles[j].Path) {
+			return len(cycles[i].Path) < len(cycles[j].Path)
+		}
+		return strings.Join(cycles[i].Path, ",") < strings.Join(cycles[j].Path, ",")
+	})
+	return cycles
+}
+
+// headPrices returns the price of the first order of every leg of the path
+func (g *RingGraph) headPrices(path []string) []*big.Int {
+	prices := make([]*big.Int, len(path))
+	for i := range path {
+		prices[i] = g.queues[path[i]][path[(i+1)%len(path)]][0].Price
+	}
+	return prices
+}
+
+// ringEdges returns the first order of every leg for the negative cycle search
+func (g *RingGraph) ringEdges() []RingEdge {
+	edges := []RingEdge{}
+	for from, tos := range g.queues {
+		for to, queue := range tos {
+			edges = append(edges, RingEdge{From: from, To: to, Price: queue[0].Price})
+		}
+	}
+	return edges
+}
+
+// BestCycle returns the ring with the highest surplus, nil when no ring leaves one. The negative
+// cycle search only answers whether a feasible ring exists: Bellman-Ford stops at whichever ring
+// it relaxes last, not the most valuable one, so the ring itself is the best entry of Cycles
+func (g *RingGraph) BestCycle() []string {
+	if NegativeCycle(g.ringEdges()) == nil {
+		return nil
+	}
+
+	cycles := g.Cycles()
+	if len(cycles) == 0 || cycles[0].Score.Sign() <= 0 {
+		return nil
+	}
+	return cycles[0].Path
+}
+
+// selfTradeConflicts returns the legs of the cycle whose first order has to be dropped so that no
+// wallet trades against itself. Order IDs grow on chain so the higher ID is the newest order, and
+// since the keeper cannot shrink an order on chain DecrementAndCancel drops the smaller one
+func (g *RingGraph) selfTradeConflicts(cyclePath []string) [][2]string {
+	if g.selfTrade == c.AllowSelfTrade {
+		return nil
+	}
+
+	seen := make(map[common.Address][2]string)
+	for i := 0; i < len(cyclePath); i++ {
+		leg := [2]string{cyclePath[i], cyclePath[(i+1)%len(cyclePath)]}
+		order := g.queues[leg[0]][leg[1]][0]
+
+		previous, ok := seen[order.UserAddress]
+		if !ok {
+			seen[order.UserAddress] = leg
+			continue
+		}
+
+		older, newer := previous, leg
+		if g.queues[older[0]][older[1]][0].OrderID > order.OrderID {
+			older, newer = leg, previous
+		}
+
+		switch g.selfTrade {
+		case c.CancelNewest:
+			return [][2]string{newer}
+		case c.CancelOldest:
+			return [][2]string{older}
+		case c.CancelBoth:
+			return [][2]string{older, newer}
+		case c.DecrementAndCancel:
+			olderQuantity := g.queues[older[0]][older[1]][0].Quantity
+			newerQuantity := g.queues[newer[0]][newer[1]][0].Quantity
+			switch olderQuantity.Cmp(newerQuantity) {
+			case -1:
+				return [][2]string{older}
+			case 1:
+				return [][2]string{newer}
+			}
+			return [][2]string{older, newer}
+		}
+	}
+	return nil
+}
+
+// DetectValidCycle returns the best ring once it holds no self trade, with the queue of
+// orders on each leg. Conflicting orders are dropped from the graph and the search restarts
+func (g *RingGraph) DetectValidCycle() ([]string, [][]ChainOrder) {
+	for {
+		cyclePath := g.BestCycle()
+		if cyclePath == nil {
+			return nil, nil
+		}
+
+		conflicts := g.selfTradeConflicts(cyclePath)
+		for _, leg := range conflicts {
+			g.dropFirstOrder(leg[0], leg[1])
+		}
+		if len(conflicts) == 0 {
+			return cyclePath, g.ringLegs(cyclePath)
+		}
+	}
+}
+
+// ringLegs returns the queue of every leg of the cycle, best price first. The first orders are
+// free of self trades, a later order is left out when its wallet already trades on another leg
+func (g *RingGraph) ringLegs(cyclePath []string) [][]ChainOrder {
+	legs := make([][]ChainOrder, len(cyclePath))
+	owners := make(map[common.Address]int)
+	for i := range cyclePath {
+		head := g.queues[cyclePath[i]][cyclePath[(i+1)%len(cyclePath)]][0]
+		legs[i] = []ChainOrder{head}
+		owners[head.UserAddress] = i
+	}
+
+	for i := range cyclePath {
+		for _, order := range g.queues[cyclePath[i]][cyclePath[(i+1)%len(cyclePath)]][1:] {
+			if leg, ok := owners[order.UserAddress]; ok && leg != i && g.selfTrade != c.AllowSelfTrade {
+				continue
+			}
+			owners[order.UserAddress] = i
+			legs[i] = append(legs[i], order)
+		}
+	}
+	return legs
+}
+
+// Clear matches rings until none leaves a surplus or maxRounds batches were found, and returns
+// one matchTrade batch per round in the order they have to be sent. Every batch is taken off the
+// queues before the next search, with the OCO siblings of its orders. A ring that rounding leaves
+// nothing to trade on loses its smallest first order and the search goes on without it
+func (g *RingGraph) Clear(maxRounds int) []RingFill {
+	fills := []RingFill{}
+	for len(fills) < maxRounds {
+		cyclePath, legs := g.DetectValidCycle()
+		if cyclePath == nil {
+			break
+		}
+
+		// every leg takes its orders in price priority, once per lap around the ring
+		fill, err := FillRing(legs)
+		if err != nil {
+			break
+		}
+
+		if fill.Laps == 0 {
+			dust := 0
+			for i, leg := range legs {
+				if leg[0].Quantity.Cmp(legs[dust][0].Quantity) < 0 {
+					dust = i
+				}
+			}
+			g.dropFirstOrder(cyclePath[dust], cyclePath[(dust+1)%len(cyclePath)])
+			continue
+		}
+
+		fills = append(fills, fill)
+		g.Consume(fill)
+		if g.oco == nil {
+			continue
+		}
+		for _, order := range fill.Orders {
+			for _, sibling := range g.oco.GetSiblings(c.OrderID(order.OrderID)) {
+				g.RemoveOrder(uint64(sibling))
+			}
+		}
+	}
+	return fills
+}
+
+// Consume takes what the fill traded off the queues, an order that is used up leaves its queue
+func (g *RingGraph) Consume(fill RingFill) {
+	for i, order := range fill.Orders {
+		from, to := order.TokenPair0.Hex(), order.TokenPair1.Hex()
+		queue := g.queues[from][to]
+		for j, queued := range queue {
+			if queued.OrderID != order.OrderID {
+				continue
+			}
+
+			// the quantity is shared with the chain snapshot, it is replaced and not decremented in place
+			left := new(big.Int).Sub(queued.Quantity, fill.Quantities[i])
+			if left.Sign() > 0 {
+				queue[j].Quantity = left
+			} else {
+				g.removeAt(from, to, j)
+			}
+			break
+		}
+	}
+}
+
+// RemoveOrder drops the order from whichever queue holds it
+func (g *RingGraph) RemoveOrder(orderID uint64) {
+	for from, tos := range g.queues {
+		for to, queue := range tos {
+			for j, order := range queue {
+				if order.OrderID == orderID {
+					g.removeAt(from, to, j)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (g *RingGraph) removeAt(from, to string, index int) {
+	queue := g.queues[from][to]
+	g.queues[from][to] = append(queue[:index:index], queue[index+1:]...)
+	if len(g.queues[from][to]) == 0 {
+		delete(g.queues[from], to)
+	}
+}
+
+// dropFirstOrder removes the order used for the from -> to leg, the next order on the pair takes its place
+func (g *RingGraph) dropFirstOrder(from, to string) {
+	g.removeAt(from, to, 0)
+}
@@ -0,0 +1,208 @@
+package class
+
+import (
+	"math/rand/v2"
+
+	"orderbook.com/m/c"
+)
+
+const (
+	skipListMaxLevel = 32
+	skipListP        = 0.25
+)
+
+// skipNode is one price level of the skip list, next holds a forward link per level and
+// prev the backward link on the bottom level so the worst level can be reached from the tail.
+// The orders of the level form an intrusive FIFO queue from head to tail, count and quantity
+// track the number of orders and their total visible quantity, hidden iceberg quantity excluded
+type skipNode struct {
+	price    c.Price
+	head     *Order
+	tail     *Order
+	count    int
+	quantity c.Quantity
+	next     []*skipNode
+	prev     *skipNode
+}
+
+// pushBack queues the order behind every other order of the level
+func (n *skipNode) pushBack(order *Order) {
+	order.level = n
+	order.prev = n.tail
+	order.next = nil
+
+	if n.tail != nil {
+		n.tail.next = order
+	} else {
+		n.head = order
+	}
+	n.tail = order
+	n.count++
+	n.quantity += order.GetVisibleQuantity()
+}
+
+// insertBefore queues the order right in front of next, which must sit in this level
+func (n *skipNode) insertBefore(order, next *Order) {
+	order.level = n
+	order.prev = next.prev
+	order.next = next
+
+	if next.prev != nil {
+		next.prev.next = order
+	} else {
+		n.head = order
+	}
+	next.prev = order
+	n.count++
+	n.quantity += order.GetVisibleQuantity()
+}
+
+// unlink takes the order out of the queue in O(1)
+func (n *skipNode) unlink(order *Order) {
+	if order.prev != nil {
+		order.prev.next = order.next
+	} else {
+		n.head = order.next
+	}
+
+	if order.next != nil {
+		order.next.prev = order.prev
+	} else {
+		n.tail = order.prev
+	}
+
+	order.prev = nil
+	order.next = nil
+	order.level = nil
+	n.count--
+	n.quantity -= order.GetVisibleQuantity()
+}
+
+// orders copies the queue into a slice, oldest order first
+func (n *skipNode) orders() []*Order {
+	orders := make([]*Order, 0, n.count)
+	for order := n.head; order != nil; order = order.next {
+		orders = append(orders, order)
+	}
+	return orders
+}
+
+// skipList keeps price levels ordered by less, insert and delete are O(log n) on average
+// while the first and last level are always one pointer away
+type skipList struct {
+	head  *skipNode
+	tail  *skipNode
+	level int
+	size  int
+	less  func(a, b c.Price) bool
+}
+
+func newSkipList(less func(a, b c.Price) bool) *skipList {
+	return &skipList{
+		head:  &skipNode{next: make([]*skipNode, skipListMaxLevel)},
+		level: 1,
+		less:  less,
+	}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.Float64() < skipListP {
+		level++
+	}
+	return level
+}
+
+// findPath returns, for every level, the last node that sorts before price
+func (sl *skipList) findPath(price c.Price) [skipListMaxLevel]*skipNode {
+	var update [skipListMaxLevel]*skipNode
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && sl.less(x.next[i].price, price) {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	return update
+}
+
+// insert links a new level for price, the caller makes sure it does not exist yet
+func (sl *skipList) insert(price c.Price) *skipNode {
+	update := sl.findPath(price)
+
+	level := randomLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			update[i] = sl.head
+		}
+		sl.level = level
+	}
+
+	node := &skipNode{price: price, next: make([]*skipNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+
+	if update[0] != sl.head {
+		node.prev = update[0]
+	}
+	if node.next[0] != nil {
+		node.next[0].prev = node
+	} else {
+		sl.tail = node
+	}
+
+	sl.size++
+	return node
+}
+
+// delete unlinks the level for price if it exists
+func (sl *skipList) delete(price c.Price) {
+	update := sl.findPath(price)
+
+	node := update[0].next[0]
+	if node == nil || node.price != price {
+		return
+	}
+
+	for i := 0; i < len(node.next); i++ {
+		update[i].next[i] = node.next[i]
+	}
+
+	if node.next[0] != nil {
+		node.next[0].prev = node.prev
+	} else {
+		sl.tail = node.prev
+	}
+
+	for sl.level > 1 && sl.head.next[sl.level-1] == nil {
+		sl.level--
+	}
+	sl.size--
+}
+
+func (sl *skipList) first() *skipNode {
+	return sl.head.next[0]
+}
+
+func (sl *skipList) last() *skipNode {
+	return sl.tail
+}
+
+// lowerBound returns the first level that does not sort before price
+func (sl *skipList) lowerBound(price c.Price) *skipNode {
+	return sl.findPath(price)[0].next[0]
+}
+
+// upperBound returns the first level that sorts after price
+func (sl *skipList) upperBound(price c.Price) *skipNode {
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && !sl.less(price, x.next[i].price) {
+			x = x.next[i]
+		}
+	}
+	return x.next[0]
+}
@@ -0,0 +1,214 @@
+package class
+
+import (
+	"fmt"
+	"math"
+
+	"orderbook.com/m/c"
+)
+
+// SortedMap keeps the orders of one side of the book grouped by price level,
+// each level holds its orders in time priority. Levels live in a skip list so that
+// adding or dropping a level is O(log n) and the best and worst level are O(1).
+// Inside a level the orders form a linked FIFO queue, every order knows its own level
+// so it can be taken out in O(1) wherever it sits in the queue
+type SortedMap struct {
+	levels       *skipList
+	index        map[c.Price]*skipNode
+	isDescending bool
+}
+
+// NewSortedMap creates an empty map, bids use descending order and asks ascending
+func NewSortedMap(isDescending bool) *SortedMap {
+	less := func(a, b c.Price) bool { return a < b }
+	if isDescending {
+		less = func(a, b c.Price) bool { return a > b }
+	}
+
+	return &SortedMap{
+		levels:       newSkipList(less),
+		index:        make(map[c.Price]*skipNode),
+		isDescending: isDescending,
+	}
+}
+
+// GetData returns a snapshot of every price level keyed by price
+func (sm *SortedMap) GetData() map[c.Price][]*Order {
+	data := make(map[c.Price][]*Order, len(sm.index))
+	for price, node := range sm.index {
+		data[price] = node.orders()
+	}
+	return data
+}
+
+func (sm *SortedMap) GetDescending() bool {
+	return sm.isDescending
+}
+
+func (sm *SortedMap) Empty() bool {
+	return sm.levels.size == 0
+}
+
+// Len returns the number of price levels
+func (sm *SortedMap) Len() int {
+	return sm.levels.size
+}
+
+// AddData appends the order to the back of its price level
+func (sm *SortedMap) AddData(price c.Price, order *Order) {
+	node, ok := sm.index[price]
+	if !ok {
+		node = sm.levels.insert(price)
+		sm.index[price] = node
+	}
+	node.pushBack(order)
+}
+
+// restore puts a removed order back in front of next, the order that followed it in its level.
+// Without next, or once next left the level, the order goes to the back of its level
+func (sm *SortedMap) restore(order, next *Order) {
+	node, ok := sm.index[order.GetPrice()]
+	if !ok || next == nil || next.level != node {
+		sm.AddData(order.GetPrice(), order)
+		return
+	}
+	node.insertBefore(order, next)
+}
+
+// clone copies the map with copies of its orders, the copy shares nothing with the book
+func (sm *SortedMap) clone() *SortedMap {
+	copied := NewSortedMap(sm.isDescending)
+	for node := sm.levels.first(); node != nil; node = node.next[0] {
+		for order := node.head; order != nil; order = order.next {
+			orderCopy := *order
+			orderCopy.level, orderCopy.prev, orderCopy.next = nil, nil, nil
+			copied.AddData(node.price, &orderCopy)
+		}
+	}
+	return copied
+}
+
+// SortData returns the price levels, best price first
+func (sm *SortedMap) SortData() []c.Price {
+	keys := make([]c.Price, 0, sm.levels.size)
+	for node := sm.levels.first(); node != nil; node = node.next[0] {
+		keys = append(keys, node.price)
+	}
+	return keys
+}
+
+// Iterate walks the price levels from best to worst until fn returns false
+func (sm *SortedMap) Iterate(fn func(price c.Price, orders []*Order) bool) {
+	for node := sm.levels.first(); node != nil; node = node.next[0] {
+		if !fn(node.price, node.orders()) {
+			return
+		}
+	}
+}
+
+func (sm *SortedMap) At(price c.Price) ([]*Order, error) {
+	node, ok := sm.index[price]
+	if !ok {
+		return nil, fmt.Errorf("price (%v) does not exist", price)
+	}
+	return node.orders(), nil
+}
+
+// Erase drops the whole price level
+func (sm *SortedMap) Erase(price c.Price) {
+	node, ok := sm.index[price]
+	if !ok {
+		return
+	}
+
+	for node.head != nil {
+		node.unlink(node.head)
+	}
+	sm.levels.delete(price)
+	delete(sm.index, price)
+}
+
+// PopFront removes the oldest order of a price level and drops the level once it is empty
+func (sm *SortedMap) PopFront(price c.Price) {
+	node, ok := sm.index[price]
+	if !ok {
+		return
+	}
+	sm.RemoveOrder(node.head)
+}
+
+// RemoveOrder takes the order out of its price level in O(1) and drops the level once it is empty
+func (sm *SortedMap) RemoveOrder(order *Order) bool {
+	node := order.level
+	if node == nil || sm.index[node.price] != node {
+		return false
+	}
+
+	node.unlink(order)
+	if node.count == 0 {
+		sm.levels.delete(node.price)
+		delete(sm.index, node.price)
+	}
+	return true
+}
+
+// refreshIceberg shows the next slice of an iceberg whose visible slice was filled and sends it
+// to the back of its price level, it reports whether there was a slice left to show
+func (sm *SortedMap) refreshIceberg(order *Order) bool {
+	node := order.level
+	if node == nil || sm.index[node.price] != node || !order.canRefresh() {
+		return false
+	}
+
+	// the used up slice counts for nothing in the level, the new one is added as it is queued
+	node.unlink(order)
+	order.refresh()
+	node.pushBack(order)
+	return true
+}
+
+// Front returns the oldest order of the best price level, nil when the map is empty
+func (sm *SortedMap) Front() *Order {
+	node := sm.levels.first()
+	if node == nil {
+		return nil
+	}
+	return node.head
+}
+
+// BestPrice returns the best price without copying its level, NaN when the map is empty
+func (sm *SortedMap) BestPrice() c.Price {
+	node := sm.levels.first()
+	if node == nil {
+		return c.Price(math.NaN())
+	}
+	return node.price
+}
+
+// Begin returns the best price level, price is NaN when the map is empty
+func (sm *SortedMap) Begin() (c.Price, []*Order) {
+	return levelOf(sm.levels.first())
+}
+
+// RBegin returns the worst price level, price is NaN when the map is empty
+func (sm *SortedMap) RBegin() (c.Price, []*Order) {
+	return levelOf(sm.levels.last())
+}
+
+// LowerBound returns the first level, in map order, that is not better than price.
+// For asks that is the lowest price >= price, for bids the highest price <= price
+func (sm *SortedMap) LowerBound(price c.Price) (c.Price, []*Order) {
+	return levelOf(sm.levels.lowerBound(price))
+}
+
+// UpperBound returns the first level, in map order, that is strictly worse than price
+func (sm *SortedMap) UpperBound(price c.Price) (c.Price, []*Order) {
+	return levelOf(sm.levels.upperBound(price))
+}
+
+func levelOf(node *skipNode) (c.Price, []*Order) {
+	if node == nil {
+		return c.Price(math.NaN()), nil
+	}
+	return node.price, node.orders()
+}
@@ -0,0 +1,101 @@
+package class
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"orderbook.com/m/fixed"
+)
+
+// Quoter returns what the pool of a market pays for amountIn, LiquidityPool.getAmountOut
+type Quoter func(amountIn *big.Int) (*big.Int, error)
+
+// SetStopLimit turns a chain Stop order into a stop-limit. Once its stop price triggers it rests
+// as a limit and is only executed while the pool pays at least limitPrice (TokenOut per TokenIn
+// scaled by 1e18) for the whole quantity. It can be set before the order shows up in a snapshot
+func (te *TriggerEngine) SetStopLimit(orderID uint64, limitPrice *big.Int) error {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	if limitPrice == nil || limitPrice.Sign() <= 0 {
+		return fmt.Errorf("order (%v) needs a positive limit price", orderID)
+	}
+	if entry, ok := te.entries[orderID]; ok && entry.order.OrderType != ChainStop {
+		return fmt.Errorf("order (%v) is not a stop order", orderID)
+	}
+
+	te.stopLimits[orderID] = new(big.Int).Set(limitPrice)
+	return nil
+}
+
+// GetStopLimit returns the limit price of a stop-limit order
+func (te *TriggerEngine) GetStopLimit(orderID uint64) (*big.Int, bool) {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	limitPrice, ok := te.stopLimits[orderID]
+	if !ok {
+		return nil, false
+	}
+	return new(big.Int).Set(limitPrice), true
+}
+
+// IsArmed reports whether the stop-limit has triggered and rests as a limit
+func (te *TriggerEngine) IsArmed(orderID uint64) bool {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	entry, ok := te.entries[orderID]
+	return ok && entry.armed
+}
+
+// NextStopLimit pops the oldest armed stop-limit of the market that can be executed right now.
+// DEX.matchTrade still checks the stop price so the market price must be at or below it, and
+// the quoted output for the whole quantity must be worth at least the limit. Every swap moves
+// the pool, so the keeper asks again with a fresh price and quote after executing each order
+func (te *TriggerEngine) NextStopLimit(market Market, marketPrice *big.Int, quote Quoter) (ChainOrder, bool, error) {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	index, ok := te.markets[market]
+	if !ok || marketPrice == nil {
+		return ChainOrder{}, false, nil
+	}
+
+	armed := make([]*triggerEntry, 0, len(index.armed))
+	for _, entry := range index.armed {
+		armed = append(armed, entry)
+	}
+	sort.Slice(armed, func(i, j int) bool { return armed[i].order.OrderID < armed[j].order.OrderID })
+
+	for _, entry := range armed {
+		order := entry.order
+		if marketPrice.Cmp(order.Price) > 0 {
+			continue
+		}
+
+		amountOut, err := quote(order.Quantity)
+		if err != nil {
+			return ChainOrder{}, false, fmt.Errorf("order (%v) could not be quoted: %w", order.OrderID, err)
+		}
+
+		// amountOut / quantity >= limit, the requirement rounds up so a partial unit never passes
+		minimumOut, err := fixed.Mul(order.Quantity, te.stopLimits[order.OrderID], fixed.Ceil)
+		if err != nil {
+			return ChainOrder{}, false, fmt.Errorf("order (%v) limit: %w", order.OrderID, err)
+		}
+		if amountOut.Cmp(minimumOut) < 0 {
+			continue
+		}
+
+		delete(index.armed, order.OrderID)
+		delete(te.entries, order.OrderID)
+		if index.Len() == 0 {
+			delete(te.markets, market)
+		}
+		return order, true, nil
+	}
+
+	return ChainOrder{}, false, nil
+}
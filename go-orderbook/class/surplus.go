@@ -0,0 +1,188 @@
+package class
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"orderbook.com/m/fixed"
+)
+
+// surplusEpsilon is the smallest log weight improvement the search accepts, float rounding
+// below it would otherwise keep relaxing a ring whose prices multiply to exactly one
+const surplusEpsilon = 1e-12
+
+// RingEdge is an order of the ring matcher's graph, it sells From for To at Price
+type RingEdge struct {
+	From  string
+	To    string
+	Price *big.Int
+}
+
+// weight is -log of what the ring receives for every To token it pays the order, log(Price).
+// A ring of negative total weight has prices that multiply to less than one and leaves a surplus
+func (e RingEdge) weight() float64 {
+	price := e.Price
+	if price == nil || price.Sign() <= 0 {
+		price = big.NewInt(1)
+	}
+	// a price past uint256 cannot be matched on chain, its leg never closes a ring
+	value, err := fixed.New(price)
+	if err != nil {
+		return math.Inf(1)
+	}
+	return math.Log(value.Float64())
+}
+
+// NegativeCycle looks for a ring with a surplus using Bellman-Ford over log price weights and
+// returns the indexes of its edges in ring order, nil when every ring costs more than it pays.
+// Float weights only decide whether a ring exists, ScoreCycle gives its exact surplus
+func NegativeCycle(edges []RingEdge) []int {
+	if len(edges) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	vertices := []string{}
+	for _, edge := range edges {
+		for _, vertex := range []string{edge.From, edge.To} {
+			if !seen[vertex] {
+				seen[vertex] = true
+				vertices = append(vertices, vertex)
+			}
+		}
+	}
+	sort.Strings(vertices)
+
+	order := make([]int, len(edges))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := edges[order[i]], edges[order[j]]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+
+	weights := make([]float64, len(edges))
+	for i, edge := range edges {
+		weights[i] = edge.weight()
+	}
+
+	// every vertex starts at zero, as if a virtual source reached all of them
+	dist := make(map[string]float64, len(vertices))
+	pred := make(map[string]int, len(vertices))
+	for _, vertex := range vertices {
+		pred[vertex] = -1
+	}
+
+	relaxed := ""
+	for pass := 0; pass < len(vertices); pass++ {
+		relaxed = ""
+		for _, i := range order {
+			edge := edges[i]
+			if edge.From == edge.To {
+				continue
+			}
+			if dist[edge.From]+weights[i] < dist[edge.To]-surplusEpsilon {
+				dist[edge.To] = dist[edge.From] + weights[i]
+				pred[edge.To] = i
+				relaxed = edge.To
+			}
+		}
+		if relaxed == "" {
+			return nil
+		}
+	}
+
+	// still relaxing after |V| passes, walking back |V| predecessors lands on the ring
+	vertex := relaxed
+	for range vertices {
+		if pred[vertex] < 0 {
+			return nil
+		}
+		vertex = edges[pred[vertex]].From
+	}
+
+	cycle := []int{}
+	for current := vertex; ; {
+		i := pred[current]
+		cycle = append(cycle, i)
+		current = edges[i].From
+		if current == vertex {
+			break
+		}
+	}
+
+	for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+		cycle[i], cycle[j] = cycle[j], cycle[i]
+	}
+	return cycle
+}
+
+// LegSurplus is what one leg of a ring trade leaves over. The order is Paid its price in Token
+// while the next order of the ring Delivers its whole quantity of it. DEX.matchTrade pays every
+// order no more than its price, so Surplus stays in the DEX, it is the improvement the owner of
+// the order could have been paid
+type LegSurplus struct {
+	OrderID     uint64
+	UserAddress common.Address
+	Token       common.Address
+	Paid        *big.Int
+	Delivered   *big.Int
+	Surplus     *big.Int
+}
+
+// RingSurplus is the surplus of a ring trade, Rate is the ScoreCycle score of its prices and Legs
+// splits the tokens left over per participant
+type RingSurplus struct {
+	Rate *big.Int
+	Legs []LegSurplus
+}
+
+// SplitSurplus works out the surplus of matching ring with quantities, the arguments of matchTrade
+func SplitSurplus(ring []ChainOrder, quantities []*big.Int) (RingSurplus, error) {
+	if len(ring) != len(quantities) {
+		return RingSurplus{}, fmt.Errorf("ring of %v orders has %v quantities", len(ring), len(quantities))
+	}
+
+	prices := make([]*big.Int, len(ring))
+	for i, order := range ring {
+		prices[i] = order.Price
+	}
+	rate, err := ScoreCycle(prices)
+	if err != nil {
+		return RingSurplus{}, err
+	}
+
+	surplus := RingSurplus{Rate: rate, Legs: make([]LegSurplus, len(ring))}
+	for i, order := range ring {
+		next := ring[(i+1)%len(ring)]
+		if order.TokenPair1 != next.TokenPair0 {
+			return RingSurplus{}, fmt.Errorf("order (%v) buys %v but order (%v) sells %v", order.OrderID, order.TokenPair1.Hex(), next.OrderID, next.TokenPair0.Hex())
+		}
+
+		paid, err := fixed.Mul(quantities[i], order.Price, fixed.Floor)
+		if err != nil {
+			return RingSurplus{}, fmt.Errorf("order (%v): %w", order.OrderID, err)
+		}
+		delivered := quantities[(i+1)%len(ring)]
+		if delivered.Cmp(paid) < 0 {
+			return RingSurplus{}, fmt.Errorf("order (%v) is paid %v but order (%v) only delivers %v", order.OrderID, paid, next.OrderID, delivered)
+		}
+
+		surplus.Legs[i] = LegSurplus{
+			OrderID:     order.OrderID,
+			UserAddress: order.UserAddress,
+			Token:       order.TokenPair1,
+			Paid:        paid,
+			Delivered:   delivered,
+			Surplus:     new(big.Int).Sub(delivered, paid),
+		}
+	}
+	return surplus, nil
+}
@@ -0,0 +1,104 @@
+package class
+
+import (
+	"time"
+
+	"orderbook.com/m/c"
+)
+
+// TradeInfo is one side of a trade
+type TradeInfo struct {
+	OrderId  c.OrderID
+	Price    c.Price
+	Quantity c.Quantity
+}
+
+// Trade pairs the bid and the ask that were matched against each other. It executes at the
+// maker's price, the maker being the order that was already resting and the taker the one that
+// crossed it. Fees are in quote units, price times quantity times the fee rate
+type Trade struct {
+	bidTrade TradeInfo
+	askTrade TradeInfo
+
+	price     c.Price
+	quantity  c.Quantity
+	takerSide c.Side
+	sequence  uint64
+	timestamp time.Time
+	makerFee  float64
+	takerFee  float64
+}
+
+type Trades []*Trade
+
+func NewTrade(bidTrade, askTrade TradeInfo) *Trade {
+	return &Trade{
+		bidTrade: bidTrade,
+		askTrade: askTrade,
+	}
+}
+
+func (t *Trade) GetBidTrade() TradeInfo {
+	return t.bidTrade
+}
+
+func (t *Trade) GetAskTrade() TradeInfo {
+	return t.askTrade
+}
+
+// GetPrice returns the execution price
+func (t *Trade) GetPrice() c.Price {
+	return t.price
+}
+
+func (t *Trade) GetQuantity() c.Quantity {
+	return t.quantity
+}
+
+// GetNotional returns the traded value in quote units
+func (t *Trade) GetNotional() float64 {
+	return float64(t.price) * float64(t.quantity)
+}
+
+func (t *Trade) GetTakerSide() c.Side {
+	return t.takerSide
+}
+
+func (t *Trade) GetMakerSide() c.Side {
+	if t.takerSide == c.BUY {
+		return c.SELL
+	}
+	return c.BUY
+}
+
+func (t *Trade) GetTakerOrderID() c.OrderID {
+	if t.takerSide == c.BUY {
+		return t.bidTrade.OrderId
+	}
+	return t.askTrade.OrderId
+}
+
+func (t *Trade) GetMakerOrderID() c.OrderID {
+	if t.takerSide == c.BUY {
+		return t.askTrade.OrderId
+	}
+	return t.bidTrade.OrderId
+}
+
+// GetSequence returns the position of the trade in the book's trade history, starting at 1
+func (t *Trade) GetSequence() uint64 {
+	return t.sequence
+}
+
+func (t *Trade) GetTimestamp() time.Time {
+	return t.timestamp
+}
+
+// GetMakerFee returns what the maker pays, negative when the schedule pays a rebate
+func (t *Trade) GetMakerFee() float64 {
+	return t.makerFee
+}
+
+func (t *Trade) GetTakerFee() float64 {
+	return t.takerFee
+}
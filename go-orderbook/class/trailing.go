@@ -0,0 +1,317 @@
+package class
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"orderbook.com/m/fixed"
+)
+
+// Trail is how far a trailing order stays behind the best price, either a fixed Amount of price
+// (scaled by 1e18 like every chain price) or Bps of the best price
+type Trail struct {
+	Amount *big.Int `json:"amount,omitempty"`
+	Bps    uint64   `json:"bps,omitempty"`
+}
+
+func (t Trail) validate() error {
+	hasAmount := t.Amount != nil && t.Amount.Sign() != 0
+	if hasAmount == (t.Bps != 0) {
+		return errors.New("trail needs exactly one of amount or bps")
+	}
+	if hasAmount && t.Amount.Sign() < 0 {
+		return errors.New("trail amount must be positive")
+	}
+	if t.Bps >= 10000 {
+		return fmt.Errorf("trail of %v bps must be below 10000", t.Bps)
+	}
+	return nil
+}
+
+// TrailingStop is a chain order whose trigger follows the market. A Stop keeps the high-water
+// mark and fires when the price falls the trail below it, a Limit keeps the low-water mark and
+// fires when the price rises the trail above it. DEX.matchTrade still checks the order's own
+// price, so the order only fires once that check passes too
+type TrailingStop struct {
+	Order ChainOrder `json:"order"`
+	Trail Trail      `json:"trail"`
+	Mark  *big.Int   `json:"mark,omitempty"`
+}
+
+// TriggerPrice returns the price the order fires at, nil until the first price has been seen
+func (s TrailingStop) TriggerPrice() (*big.Int, error) {
+	if s.Mark == nil {
+		return nil, nil
+	}
+
+	if s.Order.OrderType == ChainStop {
+		if s.Trail.Bps != 0 {
+			return fixed.MulDiv(s.Mark, big.NewInt(int64(10000-s.Trail.Bps)), big.NewInt(10000), fixed.Floor)
+		}
+		trigger := new(big.Int).Sub(s.Mark, s.Trail.Amount)
+		if trigger.Sign() < 0 {
+			trigger.SetInt64(0)
+		}
+		return trigger, nil
+	}
+
+	if s.Trail.Bps != 0 {
+		return fixed.MulDiv(s.Mark, big.NewInt(int64(10000+s.Trail.Bps)), big.NewInt(10000), fixed.Ceil)
+	}
+	return new(big.Int).Add(s.Mark, s.Trail.Amount), nil
+}
+
+// follow moves the mark with the price and reports whether it moved
+func (s *TrailingStop) follow(marketPrice *big.Int) bool {
+	if s.Mark != nil {
+		cmp := marketPrice.Cmp(s.Mark)
+		if (s.Order.OrderType == ChainStop && cmp <= 0) || (s.Order.OrderType == ChainLimit && cmp >= 0) {
+			return false
+		}
+	}
+	s.Mark = new(big.Int).Set(marketPrice)
+	return true
+}
+
+// fires reports whether the price retraced past the trail and matchTrade would accept the order
+func (s TrailingStop) fires(marketPrice *big.Int) (bool, error) {
+	trigger, err := s.TriggerPrice()
+	if err != nil || trigger == nil {
+		return false, err
+	}
+
+	if s.Order.OrderType == ChainStop {
+		return marketPrice.Cmp(trigger) <= 0 && marketPrice.Cmp(s.Order.Price) <= 0, nil
+	}
+	return marketPrice.Cmp(trigger) >= 0 && marketPrice.Cmp(s.Order.Price) >= 0, nil
+}
+
+// TrailingStops keeps the marks of every trailing order and writes them to a JSON file after
+// every change, so a restarted keeper picks up where it stopped. An empty path keeps them in memory
+type TrailingStops struct {
+	mu sync.Mutex
+
+	stops map[uint64]*TrailingStop
+	path  string
+}
+
+// NewTrailingStops loads the trailing orders saved at path, a missing file is an empty set
+func NewTrailingStops(path string) (*TrailingStops, error) {
+	ts := &TrailingStops{
+		stops: make(map[uint64]*TrailingStop),
+		path:  path,
+	}
+	if path == "" {
+		return ts, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stops []*TrailingStop
+	if err := json.Unmarshal(data, &stops); err != nil {
+		return nil, fmt.Errorf("trailing stops in %v: %w", path, err)
+	}
+	for _, stop := range stops {
+		ts.stops[stop.Order.OrderID] = stop
+	}
+	return ts, nil
+}
+
+// Add makes the chain order a trailing order, an order that is already trailing gets the new trail
+func (ts *TrailingStops) Add(order ChainOrder, trail Trail) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if order.OrderType != ChainStop && order.OrderType != ChainLimit {
+		return fmt.Errorf("order (%v) of chain type %v cannot trail", order.OrderID, order.OrderType)
+	}
+	if err := trail.validate(); err != nil {
+		return fmt.Errorf("order (%v): %w", order.OrderID, err)
+	}
+
+	stop := &TrailingStop{Order: order, Trail: trail}
+	if existing, ok := ts.stops[order.OrderID]; ok {
+		stop.Mark = existing.Mark
+	}
+	ts.stops[order.OrderID] = stop
+	return ts.save()
+}
+
+// Remove stops trailing the order, it reports whether the order was trailing
+func (ts *TrailingStops) Remove(orderID uint64) (bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if _, ok := ts.stops[orderID]; !ok {
+		return false, nil
+	}
+	delete(ts.stops, orderID)
+	return true, ts.save()
+}
+
+// GetTrailingStop returns a copy of the trailing order
+func (ts *TrailingStops) GetTrailingStop(orderID uint64) (TrailingStop, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	stop, ok := ts.stops[orderID]
+	if !ok {
+		return TrailingStop{}, false
+	}
+	return *stop, true
+}
+
+// Sync drops the trailing orders that are no longer open on chain and takes the snapshot's
+// quantity for the others
+func (ts *TrailingStops) Sync(orders []ChainOrder) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	open := make(map[uint64]ChainOrder, len(orders))
+	for _, order := range orders {
+		open[order.OrderID] = order
+	}
+
+	changed := false
+	for orderID, stop := range ts.stops {
+		order, ok := open[orderID]
+		if !ok {
+			delete(ts.stops, orderID)
+			changed = true
+			continue
+		}
+		if stop.Order.Quantity.Cmp(order.Quantity) != 0 {
+			stop.Order.Quantity = order.Quantity
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return ts.save()
+}
+
+// Exclude returns the orders that are not trailing, the ones left for the plain trigger index
+func (ts *TrailingStops) Exclude(orders []ChainOrder) []ChainOrder {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	plain := make([]ChainOrder, 0, len(orders))
+	for _, order := range orders {
+		if _, ok := ts.stops[order.OrderID]; !ok {
+			plain = append(plain, order)
+		}
+	}
+	return plain
+}
+
+// GetMarkets returns every market with a trailing order
+func (ts *TrailingStops) GetMarkets() []Market {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	seen := make(map[Market]bool)
+	markets := []Market{}
+	for _, stop := range ts.stops {
+		market := marketOf(stop.Order)
+		if !seen[market] {
+			seen[market] = true
+			markets = append(markets, market)
+		}
+	}
+	sort.Slice(markets, func(i, j int) bool { return markets[i].String() < markets[j].String() })
+	return markets
+}
+
+// Update moves the marks of the market's trailing orders with the new price and returns the ones
+// that fire, oldest first, for matchOrder. A fired order keeps trailing until Sync no longer
+// sees it on chain, so a swap that failed is retried on the next price
+func (ts *TrailingStops) Update(market Market, marketPrice *big.Int) ([]ChainOrder, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if marketPrice == nil {
+		return nil, nil
+	}
+
+	ids := make([]uint64, 0, len(ts.stops))
+	for orderID, stop := range ts.stops {
+		if marketOf(stop.Order) == market {
+			ids = append(ids, orderID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	changed := false
+	var fired []ChainOrder
+	var errs []error
+
+	for _, orderID := range ids {
+		stop := ts.stops[orderID]
+
+		ok, err := stop.fires(marketPrice)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("order (%v): %w", orderID, err))
+			continue
+		}
+		if ok {
+			fired = append(fired, stop.Order)
+			continue
+		}
+
+		if stop.follow(marketPrice) {
+			changed = true
+		}
+	}
+
+	if changed {
+		errs = append(errs, ts.save())
+	}
+	return fired, errors.Join(errs...)
+}
+
+// save writes every trailing order to a temporary file and renames it over the old one
+func (ts *TrailingStops) save() error {
+	if ts.path == "" {
+		return nil
+	}
+
+	stops := make([]*TrailingStop, 0, len(ts.stops))
+	for _, stop := range ts.stops {
+		stops = append(stops, stop)
+	}
+	sort.Slice(stops, func(i, j int) bool { return stops[i].Order.OrderID < stops[j].Order.OrderID })
+
+	data, err := json.MarshalIndent(stops, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(ts.path), filepath.Base(ts.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), ts.path)
+}
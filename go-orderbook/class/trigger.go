@@ -0,0 +1,288 @@
+package class
+
+import (
+	"bytes"
+	"container/heap"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Market is a directed pair, the orders in it sell TokenIn for TokenOut and are triggered by
+// LiquidityPool.getMarketPrice(TokenIn, TokenOut)
+type Market struct {
+	TokenIn  common.Address
+	TokenOut common.Address
+}
+
+func (m Market) String() string {
+	return m.TokenIn.Hex() + "->" + m.TokenOut.Hex()
+}
+
+// triggerEntry is an order waiting in a trigger heap, index is its position in that heap.
+// An armed entry is a triggered stop-limit, it has left the heap and rests until its limit holds
+type triggerEntry struct {
+	order ChainOrder
+	index int
+	armed bool
+}
+
+// triggerHeap keeps the order closest to triggering on top. Limits fire once the market price
+// reaches their price so the lowest price is on top, stops fire once it falls to their price so
+// the highest price is on top. Ties keep the oldest order first
+type triggerHeap struct {
+	entries []*triggerEntry
+	stop    bool
+}
+
+func (h *triggerHeap) Len() int { return len(h.entries) }
+
+func (h *triggerHeap) Less(i, j int) bool {
+	a, b := h.entries[i].order, h.entries[j].order
+	if cmp := a.Price.Cmp(b.Price); cmp != 0 {
+		return (cmp < 0) != h.stop
+	}
+	return a.OrderID < b.OrderID
+}
+
+func (h *triggerHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.entries[i].index = i
+	h.entries[j].index = j
+}
+
+func (h *triggerHeap) Push(x any) {
+	entry := x.(*triggerEntry)
+	entry.index = len(h.entries)
+	h.entries = append(h.entries, entry)
+}
+
+func (h *triggerHeap) Pop() any {
+	old := h.entries
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	h.entries = old[:len(old)-1]
+	entry.index = -1
+	return entry
+}
+
+// crossed reports whether the top order executes at this market price, the same checks
+// DEX.matchTrade does for a single order
+func (h *triggerHeap) crossed(marketPrice *big.Int) bool {
+	if len(h.entries) == 0 {
+		return false
+	}
+	if h.stop {
+		return marketPrice.Cmp(h.entries[0].order.Price) <= 0
+	}
+	return marketPrice.Cmp(h.entries[0].order.Price) >= 0
+}
+
+// TriggerIndex holds the limit and stop orders of one market sorted by trigger price and the
+// stop-limits that were triggered and now rest as limits
+type TriggerIndex struct {
+	limits *triggerHeap
+	stops  *triggerHeap
+	armed  map[uint64]*triggerEntry
+}
+
+func newTriggerIndex() *TriggerIndex {
+	return &TriggerIndex{
+		limits: &triggerHeap{},
+		stops:  &triggerHeap{stop: true},
+		armed:  make(map[uint64]*triggerEntry),
+	}
+}
+
+func (t *TriggerIndex) heapOf(orderType uint8) *triggerHeap {
+	if orderType == ChainStop {
+		return t.stops
+	}
+	return t.limits
+}
+
+// Len returns the number of orders waiting in the market
+func (t *TriggerIndex) Len() int {
+	return t.limits.Len() + t.stops.Len() + len(t.armed)
+}
+
+// TriggerEngine indexes the resting chain orders of every market by trigger price, so that a
+// new pool price only touches the orders it crosses instead of every open order
+type TriggerEngine struct {
+	mu sync.Mutex
+
+	markets    map[Market]*TriggerIndex
+	entries    map[uint64]*triggerEntry
+	stopLimits map[uint64]*big.Int
+}
+
+func NewTriggerEngine() *TriggerEngine {
+	return &TriggerEngine{
+		markets:    make(map[Market]*TriggerIndex),
+		entries:    make(map[uint64]*triggerEntry),
+		stopLimits: make(map[uint64]*big.Int),
+	}
+}
+
+func marketOf(order ChainOrder) Market {
+	return Market{TokenIn: order.TokenPair0, TokenOut: order.TokenPair1}
+}
+
+// Add indexes a limit or stop order, an order already in the index is replaced
+func (te *TriggerEngine) Add(order ChainOrder) error {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	return te.add(order)
+}
+
+func (te *TriggerEngine) add(order ChainOrder) error {
+	if order.OrderType != ChainLimit && order.OrderType != ChainStop {
+		return fmt.Errorf("order (%v) of chain type %v has no trigger price", order.OrderID, order.OrderType)
+	}
+	if order.Price == nil || order.Price.Sign() < 0 {
+		return fmt.Errorf("order (%v) has no trigger price", order.OrderID)
+	}
+
+	te.remove(order.OrderID)
+
+	market := marketOf(order)
+	index, ok := te.markets[market]
+	if !ok {
+		index = newTriggerIndex()
+		te.markets[market] = index
+	}
+
+	entry := &triggerEntry{order: order}
+	heap.Push(index.heapOf(order.OrderType), entry)
+	te.entries[order.OrderID] = entry
+	return nil
+}
+
+// Remove takes the order out of the index, it reports whether the order was there
+func (te *TriggerEngine) Remove(orderID uint64) bool {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	return te.remove(orderID)
+}
+
+func (te *TriggerEngine) remove(orderID uint64) bool {
+	entry, ok := te.entries[orderID]
+	if !ok {
+		return false
+	}
+
+	market := marketOf(entry.order)
+	index := te.markets[market]
+	if entry.armed {
+		delete(index.armed, orderID)
+	} else {
+		heap.Remove(index.heapOf(entry.order.OrderType), entry.index)
+	}
+	delete(te.entries, orderID)
+
+	if index.Len() == 0 {
+		delete(te.markets, market)
+	}
+	return true
+}
+
+// Sync brings the index in line with a getAllOrders snapshot. New orders are added, known orders
+// take the snapshot's quantity and orders missing from it are dropped. Market orders never rest
+// so they are skipped
+func (te *TriggerEngine) Sync(orders []ChainOrder) error {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	seen := make(map[uint64]bool, len(orders))
+	var errs []error
+
+	for _, order := range orders {
+		if order.OrderType == ChainMarket {
+			continue
+		}
+		seen[order.OrderID] = true
+
+		if entry, ok := te.entries[order.OrderID]; ok && entry.order.Price.Cmp(order.Price) == 0 {
+			entry.order.Quantity = order.Quantity
+			continue
+		}
+		if err := te.add(order); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for orderID := range te.entries {
+		if !seen[orderID] {
+			te.remove(orderID)
+			delete(te.stopLimits, orderID)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Trigger pops every order of the market that executes at marketPrice, limits first then stops,
+// each in the order they crossed. Popped orders leave the index, the next Sync brings back any
+// that are still open on chain. Stop-limits are not returned, they are armed and wait for
+// NextStopLimit
+func (te *TriggerEngine) Trigger(market Market, marketPrice *big.Int) []ChainOrder {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	index, ok := te.markets[market]
+	if !ok || marketPrice == nil {
+		return nil
+	}
+
+	var triggered []ChainOrder
+	for _, h := range []*triggerHeap{index.limits, index.stops} {
+		for h.crossed(marketPrice) {
+			entry := heap.Pop(h).(*triggerEntry)
+			if _, ok := te.stopLimits[entry.order.OrderID]; ok {
+				entry.armed = true
+				index.armed[entry.order.OrderID] = entry
+				continue
+			}
+
+			delete(te.entries, entry.order.OrderID)
+			triggered = append(triggered, entry.order)
+		}
+	}
+
+	if index.Len() == 0 {
+		delete(te.markets, market)
+	}
+	return triggered
+}
+
+// GetMarkets returns every market with a waiting order, the only ones that need a price
+func (te *TriggerEngine) GetMarkets() []Market {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	markets := make([]Market, 0, len(te.markets))
+	for market := range te.markets {
+		markets = append(markets, market)
+	}
+	sort.Slice(markets, func(i, j int) bool {
+		if cmp := bytes.Compare(markets[i].TokenIn.Bytes(), markets[j].TokenIn.Bytes()); cmp != 0 {
+			return cmp < 0
+		}
+		return bytes.Compare(markets[i].TokenOut.Bytes(), markets[j].TokenOut.Bytes()) < 0
+	})
+	return markets
+}
+
+// Len returns the number of indexed orders
+func (te *TriggerEngine) Len() int {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+
+	return len(te.entries)
+}
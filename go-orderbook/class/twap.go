@@ -0,0 +1,262 @@
+package class
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"orderbook.com/m/fixed"
+)
+
+// twapSearchSteps bounds the getAmountOut calls spent sizing one child
+const twapSearchSteps = 32
+
+// ErrTWAPStopped is returned by Step once the parent is completed, cancelled or failed
+var ErrTWAPStopped = errors.New("twap is no longer running")
+
+// Pricer returns the pool's market price of a market, LiquidityPool.getMarketPrice
+type Pricer func() (*big.Int, error)
+
+// Executor swaps amountIn through the pool and returns what it received
+type Executor func(amountIn *big.Int) (*big.Int, error)
+
+type TWAPStatus int
+
+const (
+	TWAPRunning TWAPStatus = iota
+	TWAPCompleted
+	TWAPCancelled
+	TWAPFailed
+)
+
+func (s TWAPStatus) String() string {
+	switch s {
+	case TWAPRunning:
+		return "Running"
+	case TWAPCompleted:
+		return "Completed"
+	case TWAPCancelled:
+		return "Cancelled"
+	case TWAPFailed:
+		return "Failed"
+	}
+	return "Unknown"
+}
+
+// TWAPParams describes a parent order. Total of the market's TokenIn is spread evenly over Slices
+// ticks, and no child may get an average price more than MaxImpactBps below the market price.
+// A child the cap shrinks leaves the rest for later ticks, the parent runs past Slices ticks
+// until everything is sold
+type TWAPParams struct {
+	Total        *big.Int
+	Slices       int
+	MaxImpactBps uint64
+}
+
+// TWAPProgress is a snapshot of the parent order
+type TWAPProgress struct {
+	Status   TWAPStatus
+	Executed *big.Int
+	Received *big.Int
+	Children int
+	Ticks    int
+	Err      error
+}
+
+// GetRemaining returns what is left to sell
+func (p TWAPProgress) GetRemaining(total *big.Int) *big.Int {
+	return new(big.Int).Sub(total, p.Executed)
+}
+
+// GetAveragePrice returns the TokenOut received per TokenIn sold scaled by 1e18, nil before the
+// first child
+func (p TWAPProgress) GetAveragePrice() *big.Int {
+	if p.Executed.Sign() == 0 {
+		return nil
+	}
+	price, _ := fixed.Div(p.Received, p.Executed, fixed.Floor)
+	return price
+}
+
+// TWAP slices a parent order into child swaps, one per tick. Ticks come from whatever drives
+// Run, a timer for wall-clock intervals or new block headers for block intervals
+type TWAP struct {
+	mu sync.Mutex
+
+	params  TWAPParams
+	quote   Quoter
+	price   Pricer
+	execute Executor
+
+	progress TWAPProgress
+	done     chan struct{}
+}
+
+func NewTWAP(params TWAPParams, quote Quoter, price Pricer, execute Executor) (*TWAP, error) {
+	if params.Total == nil || params.Total.Sign() <= 0 {
+		return nil, errors.New("twap total must be positive")
+	}
+	if params.Slices <= 0 {
+		return nil, fmt.Errorf("twap needs at least one slice, got %v", params.Slices)
+	}
+	if params.MaxImpactBps == 0 || params.MaxImpactBps >= 10000 {
+		return nil, fmt.Errorf("twap impact cap of %v bps must be between 1 and 9999", params.MaxImpactBps)
+	}
+
+	return &TWAP{
+		params:  TWAPParams{Total: new(big.Int).Set(params.Total), Slices: params.Slices, MaxImpactBps: params.MaxImpactBps},
+		quote:   quote,
+		price:   price,
+		execute: execute,
+		progress: TWAPProgress{
+			Executed: new(big.Int),
+			Received: new(big.Int),
+		},
+		done: make(chan struct{}),
+	}, nil
+}
+
+// GetProgress returns a copy of the parent's progress
+func (t *TWAP) GetProgress() TWAPProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	progress := t.progress
+	progress.Executed = new(big.Int).Set(t.progress.Executed)
+	progress.Received = new(big.Int).Set(t.progress.Received)
+	return progress
+}
+
+// Done is closed once the parent is completed, cancelled or failed
+func (t *TWAP) Done() <-chan struct{} {
+	return t.done
+}
+
+// Cancel stops the parent, a child that is being executed still finishes
+func (t *TWAP) Cancel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.finish(TWAPCancelled, nil)
+}
+
+func (t *TWAP) finish(status TWAPStatus, err error) {
+	if t.progress.Status != TWAPRunning {
+		return
+	}
+	t.progress.Status = status
+	t.progress.Err = err
+	close(t.done)
+}
+
+// Run executes one child per tick until the parent is done or ticks is closed
+func (t *TWAP) Run(ticks <-chan struct{}) {
+	for {
+		select {
+		case <-t.done:
+			return
+		case _, ok := <-ticks:
+			if !ok {
+				return
+			}
+			t.Step()
+		}
+	}
+}
+
+// Step sizes and executes the child of the current tick and returns its amount in, zero when the
+// impact cap leaves nothing to sell this tick
+func (t *TWAP) Step() (*big.Int, error) {
+	t.mu.Lock()
+	if t.progress.Status != TWAPRunning {
+		t.mu.Unlock()
+		return nil, ErrTWAPStopped
+	}
+
+	t.progress.Ticks++
+	remaining := new(big.Int).Sub(t.params.Total, t.progress.Executed)
+	slicesLeft := max(t.params.Slices-t.progress.Ticks+1, 1)
+	t.mu.Unlock()
+
+	// the even share of what is left, rounded up so the last slice finishes the parent
+	target, _ := fixed.MulDiv(remaining, big.NewInt(1), big.NewInt(int64(slicesLeft)), fixed.Ceil)
+
+	size, err := t.childSize(target)
+	if err != nil {
+		t.fail(err)
+		return nil, err
+	}
+	if size.Sign() == 0 {
+		return size, nil
+	}
+
+	received, err := t.execute(size)
+	if err != nil {
+		t.fail(fmt.Errorf("child of %v: %w", size, err))
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.progress.Executed.Add(t.progress.Executed, size)
+	t.progress.Received.Add(t.progress.Received, received)
+	t.progress.Children++
+	if t.progress.Executed.Cmp(t.params.Total) >= 0 {
+		t.finish(TWAPCompleted, nil)
+	}
+	return size, nil
+}
+
+func (t *TWAP) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.finish(TWAPFailed, err)
+}
+
+// childSize returns the largest amount up to target whose quoted output stays within the impact
+// cap. Output per input only falls as the amount grows, so the curve is searched by bisection
+func (t *TWAP) childSize(target *big.Int) (*big.Int, error) {
+	spot, err := t.price()
+	if err != nil {
+		return nil, fmt.Errorf("market price: %w", err)
+	}
+
+	// amountOut * 1e18 * 10000 >= spot * amountIn * (10000 - cap)
+	floor := new(big.Int).Mul(spot, big.NewInt(int64(10000-t.params.MaxImpactBps)))
+	scale := new(big.Int).Mul(fixed.One(), big.NewInt(10000))
+	withinCap := func(amountIn *big.Int) (bool, error) {
+		amountOut, err := t.quote(amountIn)
+		if err != nil {
+			return false, fmt.Errorf("quote of %v: %w", amountIn, err)
+		}
+		got := new(big.Int).Mul(amountOut, scale)
+		return got.Cmp(new(big.Int).Mul(floor, amountIn)) >= 0, nil
+	}
+
+	if ok, err := withinCap(target); err != nil || ok {
+		return target, err
+	}
+
+	low, high := new(big.Int), new(big.Int).Set(target)
+	for step := 0; step < twapSearchSteps; step++ {
+		mid := new(big.Int).Add(low, high)
+		mid.Rsh(mid, 1)
+		if mid.Cmp(low) == 0 {
+			break
+		}
+
+		ok, err := withinCap(mid)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return low, nil
+}
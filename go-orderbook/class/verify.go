@@ -0,0 +1,239 @@
+package class
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"orderbook.com/m/fixed"
+)
+
+// PairPricer returns the pool's market price of tokenIn in tokenOut, LiquidityPool.getMarketPrice
+type PairPricer func(tokenIn, tokenOut common.Address) (*big.Int, error)
+
+// ViolationKind is the require of DEX.matchTrade a batch would fail
+type ViolationKind int
+
+const (
+	// ViolationLength means the order list and the quantities have different lengths
+	ViolationLength ViolationKind = iota
+	// ViolationEmpty means the batch holds no order, matchTrade would spend gas on nothing
+	ViolationEmpty
+	// ViolationUnknownOrder means the order is not open on chain
+	ViolationUnknownOrder
+	// ViolationOrderType means a single order is neither a Limit nor a Stop
+	ViolationOrderType
+	// ViolationCycle means the order does not buy what the next one sells
+	ViolationCycle
+	// ViolationMarketPrice means the pool price of the order's pair could not be read
+	ViolationMarketPrice
+	// ViolationLimitPrice means the market price does not let the limit order trade
+	ViolationLimitPrice
+	// ViolationStopPrice means the market price does not let the stop order trade
+	ViolationStopPrice
+	// ViolationPricing means the next order delivers less than the order's price of its quantity
+	ViolationPricing
+	// ViolationOverfill means the quantities of an order add up to more than it holds, the trade
+	// after the one that deletes it reverts in _delOrderTrade
+	ViolationOverfill
+)
+
+func (k ViolationKind) String() string {
+	switch k {
+	case ViolationLength:
+		return "Length"
+	case ViolationEmpty:
+		return "Empty"
+	case ViolationUnknownOrder:
+		return "UnknownOrder"
+	case ViolationOrderType:
+		return "OrderType"
+	case ViolationCycle:
+		return "Cycle"
+	case ViolationMarketPrice:
+		return "MarketPrice"
+	case ViolationLimitPrice:
+		return "LimitPrice"
+	case ViolationStopPrice:
+		return "StopPrice"
+	case ViolationPricing:
+		return "Pricing"
+	case ViolationOverfill:
+		return "Overfill"
+	}
+	return "Unknown"
+}
+
+// Violation is a require of matchTrade the batch would fail. Index is the position in the order
+// list, -1 when the batch as a whole is invalid
+type Violation struct {
+	Kind    ViolationKind
+	Index   int
+	OrderID uint64
+	Message string
+}
+
+func (v Violation) Error() string {
+	if v.Index < 0 {
+		return fmt.Sprintf("%v: %v", v.Kind, v.Message)
+	}
+	return fmt.Sprintf("%v at %v: %v", v.Kind, v.Index, v.Message)
+}
+
+// Verifier replays the checks of DEX.matchTrade on a batch before it is signed, against the
+// open orders of the last snapshot and the pool prices. Apply takes a sent batch off the orders
+// like _delOrderTrade, so the batches that follow it are checked against what it left
+type Verifier struct {
+	orders map[uint64]ChainOrder
+	price  PairPricer
+}
+
+func NewVerifier(orders []ChainOrder, price PairPricer) *Verifier {
+	v := &Verifier{
+		orders: make(map[uint64]ChainOrder, len(orders)),
+		price:  price,
+	}
+	for _, order := range orders {
+		v.orders[order.OrderID] = order
+	}
+	return v
+}
+
+// Verify returns every require the batch would fail, none when matchTrade would accept it.
+// Prices are read once per pair and call, a single order swaps through the pool and moves them
+func (v *Verifier) Verify(orderIDs []uint64, quantities []*big.Int) []Violation {
+	if len(orderIDs) != len(quantities) {
+		return []Violation{{Kind: ViolationLength, Index: -1, Message: fmt.Sprintf("%v orders but %v quantities", len(orderIDs), len(quantities))}}
+	}
+	if len(orderIDs) == 0 {
+		return []Violation{{Kind: ViolationEmpty, Index: -1, Message: "no orders to match"}}
+	}
+
+	prices := make(map[Market]*big.Int)
+	marketPrice := func(i int, order ChainOrder) (*big.Int, *Violation) {
+		market := marketOf(order)
+		if price, ok := prices[market]; ok {
+			return price, nil
+		}
+		price, err := v.price(order.TokenPair0, order.TokenPair1)
+		if err == nil && price == nil {
+			err = errors.New("no price")
+		}
+		if err != nil {
+			return nil, &Violation{Kind: ViolationMarketPrice, Index: i, OrderID: order.OrderID, Message: fmt.Sprintf("market %v: %v", market, err)}
+		}
+		prices[market] = price
+		return price, nil
+	}
+
+	violations := []Violation{}
+	unknown := func(i int, orderID uint64) Violation {
+		return Violation{Kind: ViolationUnknownOrder, Index: i, OrderID: orderID, Message: fmt.Sprintf("order (%v) is not open", orderID)}
+	}
+
+	if len(orderIDs) == 1 {
+		order, ok := v.orders[orderIDs[0]]
+		if !ok {
+			return []Violation{unknown(0, orderIDs[0])}
+		}
+		if order.OrderType != ChainLimit && order.OrderType != ChainStop {
+			return []Violation{{Kind: ViolationOrderType, Index: 0, OrderID: order.OrderID, Message: fmt.Sprintf("order (%v) of chain type %v cannot be matched alone", order.OrderID, order.OrderType)}}
+		}
+
+		price, violation := marketPrice(0, order)
+		switch {
+		case violation != nil:
+			violations = append(violations, *violation)
+		case order.OrderType == ChainLimit && price.Cmp(order.Price) < 0:
+			violations = append(violations, Violation{Kind: ViolationLimitPrice, Index: 0, OrderID: order.OrderID, Message: fmt.Sprintf("order (%v) limit at %v is above the market price %v", order.OrderID, order.Price, price)})
+		case order.OrderType == ChainStop && price.Cmp(order.Price) > 0:
+			violations = append(violations, Violation{Kind: ViolationStopPrice, Index: 0, OrderID: order.OrderID, Message: fmt.Sprintf("order (%v) stop at %v is below the market price %v", order.OrderID, order.Price, price)})
+		}
+		return append(violations, v.overfills(orderIDs, quantities)...)
+	}
+
+	for i, orderID := range orderIDs {
+		next := (i + 1) % len(orderIDs)
+
+		start, ok := v.orders[orderID]
+		if !ok {
+			violations = append(violations, unknown(i, orderID))
+			continue
+		}
+		end, ok := v.orders[orderIDs[next]]
+		if !ok {
+			continue
+		}
+
+		if start.TokenPair1 != end.TokenPair0 {
+			violations = append(violations, Violation{Kind: ViolationCycle, Index: i, OrderID: orderID, Message: fmt.Sprintf("order (%v) buys %v but order (%v) sells %v", orderID, start.TokenPair1.Hex(), end.OrderID, end.TokenPair0.Hex())})
+		}
+
+		price, violation := marketPrice(i, start)
+		switch {
+		case violation != nil:
+			violations = append(violations, *violation)
+		case start.OrderType == ChainLimit && start.Price.Cmp(price) >= 0:
+			violations = append(violations, Violation{Kind: ViolationLimitPrice, Index: i, OrderID: orderID, Message: fmt.Sprintf("order (%v) limit at %v is not below the market price %v", orderID, start.Price, price)})
+		case start.OrderType == ChainStop && start.Price.Cmp(price) <= 0:
+			violations = append(violations, Violation{Kind: ViolationStopPrice, Index: i, OrderID: orderID, Message: fmt.Sprintf("order (%v) stop at %v is not above the market price %v", orderID, start.Price, price)})
+		}
+
+		paid, err := fixed.Mul(quantities[i], start.Price, fixed.Floor)
+		if err != nil {
+			violations = append(violations, Violation{Kind: ViolationPricing, Index: i, OrderID: orderID, Message: fmt.Sprintf("order (%v): %v", orderID, err)})
+		} else if quantities[next].Cmp(paid) < 0 {
+			violations = append(violations, Violation{Kind: ViolationPricing, Index: i, OrderID: orderID, Message: fmt.Sprintf("order (%v) is paid %v but order (%v) only delivers %v", orderID, paid, end.OrderID, quantities[next])})
+		}
+	}
+	return append(violations, v.overfills(orderIDs, quantities)...)
+}
+
+// overfills replays _delOrderTrade over the batch, an order is deleted by the quantity that
+// reaches what it holds and any later trade of it reverts
+func (v *Verifier) overfills(orderIDs []uint64, quantities []*big.Int) []Violation {
+	violations := []Violation{}
+	remaining := make(map[uint64]*big.Int)
+	for i, orderID := range orderIDs {
+		order, ok := v.orders[orderID]
+		if !ok {
+			continue
+		}
+
+		left, ok := remaining[orderID]
+		if !ok {
+			left = new(big.Int).Set(order.Quantity)
+			remaining[orderID] = left
+		}
+		if left.Sign() <= 0 {
+			violations = append(violations, Violation{Kind: ViolationOverfill, Index: i, OrderID: orderID, Message: fmt.Sprintf("order (%v) is already used up", orderID)})
+			continue
+		}
+		if quantities[i].Cmp(left) > 0 {
+			violations = append(violations, Violation{Kind: ViolationOverfill, Index: i, OrderID: orderID, Message: fmt.Sprintf("order (%v) trades %v but only %v is left", orderID, quantities[i], left)})
+		}
+		left.Sub(left, quantities[i])
+	}
+	return violations
+}
+
+// Apply takes a batch that was sent off the known orders, like _delOrderTrade does on chain
+func (v *Verifier) Apply(orderIDs []uint64, quantities []*big.Int) {
+	for i, orderID := range orderIDs {
+		if i >= len(quantities) {
+			return
+		}
+		order, ok := v.orders[orderID]
+		if !ok {
+			continue
+		}
+
+		if quantities[i].Cmp(order.Quantity) < 0 {
+			order.Quantity = new(big.Int).Sub(order.Quantity, quantities[i])
+			v.orders[orderID] = order
+		} else {
+			delete(v.orders, orderID)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Package fixed does the 1e18 fixed-point arithmetic of the contracts. Results are bit-exact
+// with PRBMath.mulDiv, which DEX._multiply and LiquidityPool.getAmountOut use, and every
+// operation takes an explicit rounding mode
+package fixed
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Decimals of every 1e18 scaled value
+const Decimals = 18
+
+// Rounding decides which way a result that is not exact goes
+type Rounding int
+
+const (
+	// Floor rounds down, it is what Solidity integer division and PRBMath.mulDiv do
+	Floor Rounding = iota
+	// Ceil rounds up
+	Ceil
+)
+
+var (
+	scale      = new(big.Int).Exp(big.NewInt(10), big.NewInt(Decimals), nil)
+	maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+	ErrDivisionByZero = errors.New("fixed: division by zero")
+	ErrOverflow       = errors.New("fixed: result does not fit in uint256")
+	ErrOutOfRange     = errors.New("fixed: operand is not a uint256")
+)
+
+// One returns 1e18, the scaled representation of 1
+func One() *big.Int {
+	return new(big.Int).Set(scale)
+}
+
+// MulDiv returns x * y / denominator with a full precision intermediate product. Like
+// PRBMath.mulDiv it fails when an operand is not a uint256 or the result overflows one
+func MulDiv(x, y, denominator *big.Int, rounding Rounding) (*big.Int, error) {
+	for _, operand := range []*big.Int{x, y, denominator} {
+		if operand == nil || operand.Sign() < 0 || operand.Cmp(maxUint256) > 0 {
+			return nil, ErrOutOfRange
+		}
+	}
+	if denominator.Sign() == 0 {
+		return nil, ErrDivisionByZero
+	}
+
+	product := new(big.Int).Mul(x, y)
+	result, remainder := new(big.Int).QuoRem(product, denominator, new(big.Int))
+	if rounding == Ceil && remainder.Sign() != 0 {
+		result.Add(result, big.NewInt(1))
+	}
+
+	if result.Cmp(maxUint256) > 0 {
+		return nil, ErrOverflow
+	}
+	return result, nil
+}
+
+// Mul multiplies two 1e18 scaled values, with Floor it is exactly DEX._multiply
+func Mul(x, y *big.Int, rounding Rounding) (*big.Int, error) {
+	return MulDiv(x, y, scale, rounding)
+}
+
+// Div divides two 1e18 scaled values
+func Div(x, y *big.Int, rounding Rounding) (*big.Int, error) {
+	return MulDiv(x, scale, y, rounding)
+}
+
+// UD60x18 is an unsigned 1e18 scaled value, the Go side of PRBMath's type of the same name
+type UD60x18 struct {
+	raw *big.Int
+}
+
+// New wraps a raw scaled value such as an on-chain price
+func New(raw *big.Int) (UD60x18, error) {
+	if raw == nil || raw.Sign() < 0 || raw.Cmp(maxUint256) > 0 {
+		return UD60x18{}, ErrOutOfRange
+	}
+	return UD60x18{raw: new(big.Int).Set(raw)}, nil
+}
+
+// FromInt returns n as a scaled value
+func FromInt(n uint64) UD60x18 {
+	return UD60x18{raw: new(big.Int).Mul(new(big.Int).SetUint64(n), scale)}
+}
+
+// Parse reads a decimal string such as "1.5", digits past the 18th decimal are rejected
+func Parse(s string) (UD60x18, error) {
+	whole, fraction, _ := strings.Cut(s, ".")
+	if len(fraction) > Decimals {
+		return UD60x18{}, fmt.Errorf("fixed: %q has more than %d decimals", s, Decimals)
+	}
+
+	raw, ok := new(big.Int).SetString(whole+fraction+strings.Repeat("0", Decimals-len(fraction)), 10)
+	if !ok {
+		return UD60x18{}, fmt.Errorf("fixed: %q is not a decimal number", s)
+	}
+	return New(raw)
+}
+
+// Raw returns a copy of the scaled value
+func (x UD60x18) Raw() *big.Int {
+	if x.raw == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(x.raw)
+}
+
+func (x UD60x18) Mul(y UD60x18, rounding Rounding) (UD60x18, error) {
+	raw, err := Mul(x.Raw(), y.Raw(), rounding)
+	if err != nil {
+		return UD60x18{}, err
+	}
+	return UD60x18{raw: raw}, nil
+}
+
+func (x UD60x18) Div(y UD60x18, rounding Rounding) (UD60x18, error) {
+	raw, err := Div(x.Raw(), y.Raw(), rounding)
+	if err != nil {
+		return UD60x18{}, err
+	}
+	return UD60x18{raw: raw}, nil
+}
+
+func (x UD60x18) Cmp(y UD60x18) int {
+	return x.Raw().Cmp(y.Raw())
+}
+
+func (x UD60x18) IsZero() bool {
+	return x.raw == nil || x.raw.Sign() == 0
+}
+
+// Float64 returns the nearest float64, only meant for display and the float priced book
+func (x UD60x18) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(x.Raw(), scale).Float64()
+	return f
+}
+
+// String prints the exact decimal value without trailing zeros
+func (x UD60x18) String() string {
+	whole, fraction := new(big.Int).QuoRem(x.Raw(), scale, new(big.Int))
+	if fraction.Sign() == 0 {
+		return whole.String()
+	}
+
+	digits := fmt.Sprintf("%0*s", Decimals, fraction.String())
+	return whole.String() + "." + strings.TrimRight(digits, "0")
+}
@@ -17,303 +17,38 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"orderbook.com/m/c"
+	"orderbook.com/m/class"
+	"orderbook.com/m/fixed"
 )
 
-// Mock marketPrice function that returns a cached price for a given (from, to) pair
-
-// NewGraph creates and returns a new directed graph
-func NewGraph() *Graph {
-	return &Graph{
-		adjacencyList: make(map[string]map[string][]Edge),
-		visited:       make(map[string]bool),
-		recStack:      make(map[string]bool),
-	}
-}
-
-// AddEdge adds a directed edge from vertex A to vertex B with order details
-func (g *Graph) AddEdge(A, B string, orderID uint64, price, quantity *big.Int, orderType uint8) {
-	edge := Edge{OrderID: orderID, Price: price, Quantity: quantity, OrderType: orderType}
-
-	// Initialize adjacency list for vertex A if it doesn't exist
-	if g.adjacencyList[A] == nil {
-		g.adjacencyList[A] = make(map[string][]Edge)
-	}
-
-	// Append the edge only in the direction A -> B
-	g.adjacencyList[A][B] = append(g.adjacencyList[A][B], edge)
-}
-
-// hasCycleHelper is a recursive function to detect a single cycle in a directed graph
-// and return the cycle path if detected.
-func (g *Graph) hasCycleHelper(v string, path []string) ([]string, bool) {
-	g.visited[v] = true
-	g.recStack[v] = true
-	path = append(path, v)
-
-	for neighbor := range g.adjacencyList[v] {
-		if !g.visited[neighbor] {
-			// Recur with path including the current neighbor
-			if cyclePath, found := g.hasCycleHelper(neighbor, path); found {
-				return cyclePath, true
-			}
-		} else if g.recStack[neighbor] { // Cycle detected
-			// Extract the cycle path from path slice up to the repeated node
-			cyclePath := []string{}
-			for i := len(path) - 1; i >= 0; i-- {
-				cyclePath = append([]string{path[i]}, cyclePath...)
-				if path[i] == neighbor {
-					break
-				}
-			}
-			return cyclePath, true
-		}
-	}
-
-	g.recStack[v] = false
-	return nil, false
-}
-
-func (g *Graph) DetectValidCycle() ([]string, map[string]map[string]Edge, []uint64) {
-	// Reset visited and recStack maps for fresh cycle detection
-	g.visited = make(map[string]bool)
-	g.recStack = make(map[string]bool)
-
-	var orderIDs []uint64
-
-	oneEighteen := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
-	oneEighteenFloat := new(big.Float).SetInt(oneEighteen)
-
-	// Find the first cycle
-	for node := range g.adjacencyList {
-		if !g.visited[node] {
-			if cyclePath, found := g.hasCycleHelper(node, []string{}); found {
-				fmt.Println()
-				fmt.Println()
-				fmt.Println("Cycle detected:", cyclePath)
-
-				// Create a map to store the valid edges of the cycle
-				validCycleEdges := make(map[string]map[string]Edge)
-
-				// Process the valid edges and filter out the invalid ones
-				for i := 0; i < len(cyclePath); i++ {
-					from := cyclePath[i%len(cyclePath)]
-					to := cyclePath[(i+1)%len(cyclePath)]
-
-					priceFloat := new(big.Float).SetInt(g.adjacencyList[from][to][0].Price)
-
-					fmt.Printf("From -> To: %v -> %v\n", from, to)
-					fmt.Printf("Price: %v  Quantity: %v\n", new(big.Float).Quo(priceFloat, oneEighteenFloat), g.adjacencyList[from][to][0].Quantity)
-
-					if validCycleEdges[from] == nil {
-						validCycleEdges[from] = make(map[string]Edge)
-					}
-
-					orderIDs = append(orderIDs, g.adjacencyList[from][to][0].OrderID)
-					validCycleEdges[from][to] = g.adjacencyList[from][to][0]
-				}
-
-				return cyclePath, validCycleEdges, orderIDs
-			}
-		}
-	}
-
-	fmt.Println("No cycles detected.")
-	return nil, nil, nil
-}
-
-func (g *Graph) calculateMinimumAdjustedQuantities(cyclePath []string, validCycleEdges map[string]map[string]Edge) []*big.Int {
-	if len(cyclePath) < 2 {
-		fmt.Println("Cycle must contain at least two orders.")
-		return []*big.Int{}
-	}
-
-	// Define a "max" value for *big.Int
-	maxBigInt := new(big.Int)
-	maxBigInt.SetString("179769313486231570814527423731704356258019319424456580314817725994201445298688", 10)
-
-	// Initialize minimum quantity and minIndex
-	minQuantity := maxBigInt
-	minIndex := -1
-
-	// Define 1e18 as a bigInt
-	oneEighteen := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
-	oneEighteenFloat := new(big.Float).SetInt(oneEighteen)
-
-	// Process the cycle and compare quantities
-
-	for i := 0; i < len(cyclePath); i++ {
-		start := cyclePath[i%len(cyclePath)]
-		end := cyclePath[(i+1)%len(cyclePath)]
-
-		// Get the valid edges for the start and end orders
-		startEdge := validCycleEdges[start][end]
-		endEdge := validCycleEdges[end][cyclePath[(i+2)%len(cyclePath)]]
-
-		fmt.Println()
-		fmt.Println()
-		fmt.Printf("From -> To: %v -> %v\n", start, end)
-		fmt.Printf("From -> To: %v -> %v\n", end, cyclePath[(i+2)%len(cyclePath)])
-
-		// Calculate adjusted quantities for the start and end orders
-		var adjustedQuantity *big.Int
-		if startEdge.Price.Cmp(oneEighteen) >= 0 {
-			price := new(big.Float).SetInt(startEdge.Price)
-			price = new(big.Float).Quo(price, oneEighteenFloat)
-
-			fmt.Println("price:", price)
-
-			quantityFloat := new(big.Float).SetInt(endEdge.Quantity)
-			fmt.Println("quantityFloat:", quantityFloat)
-			resultFloat := new(big.Float).Quo(quantityFloat, price)
-
-			adjustedQuantity = new(big.Int)
-			resultFloat.Int(adjustedQuantity)
-			fmt.Println("adjustedQuantity:", adjustedQuantity)
-
-		} else {
-			adjustedQuantity = endEdge.Quantity
-		}
-
-		fmt.Println("adjustedQuantity:", adjustedQuantity)
-
-		// Check and update minimum quantity logic
-		if adjustedQuantity.Cmp(minQuantity) <= 0 {
-			minQuantity = adjustedQuantity
-			minIndex = (i + 1) % len(cyclePath)
-		}
-	}
-
-	// Output the minimum quantity and the corresponding order index
-	if minIndex != -1 {
-		fmt.Printf("minQuantity: %v\n", minQuantity) // %v prints the value in its default form
-		fmt.Printf("minIndex: %d\n", minIndex)       // %d prints the integer value of minIn
-		return g.countQuantity(cyclePath, validCycleEdges, minQuantity, minIndex)
-	} else {
-		fmt.Println("No valid minimum quantity found.")
-		return []*big.Int{}
-	}
-}
-
-func (g *Graph) countQuantity(cyclePath []string, validCycleEdges map[string]map[string]Edge, minQuantity *big.Int, minIndex int) []*big.Int {
-	// Initialize a temporary list with the same length as cyclePath
-	tempQuantities := make([]*big.Int, len(cyclePath))
-
-	// Set the quantity at minimum index to the minimum quantity
-	tempQuantities[minIndex] = minQuantity
-
-	// Set the initial multiplier
-	multiplier := minQuantity
-	fmt.Println("")
-	fmt.Println("")
-
-	fmt.Println("Calculated Quantities: ", tempQuantities)
-
-	oneEighteen := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
-
-	// Loop through the cycle and calculate the quantities
-	for i := 0; i < len(cyclePath)-1; i++ {
-		start := cyclePath[minIndex%len(cyclePath)]
-		end := cyclePath[(minIndex+1)%len(cyclePath)]
-
-		// Get the valid edges for the start and end orders
-		edge := validCycleEdges[start][end]
-		//fmt.Printf("start %v : end  %v  price: %v \n", start, end, edge.Price)
-
-		// Calculate next quantity for the current edge
-		fmt.Println("Multiplier:  ", multiplier, "   edge.Price:   ", edge.Price)
-		nextQuantity := new(big.Int).Mul(multiplier, edge.Price)
-		nextQuantity.Div(nextQuantity, oneEighteen)
-
-		// Store the next quantity in the tempQuantities array
-		tempQuantities[(minIndex+1)%len(cyclePath)] = nextQuantity
-
-		// Update the multiplier for the next iteration
-		multiplier = nextQuantity
-		fmt.Println("Calculated Quantities: ", tempQuantities)
-
-		minIndex++
-
+// formatFixed prints a 1e18 scaled amount as a decimal
+func formatFixed(raw *big.Int) string {
+	value, err := fixed.New(raw)
+	if err != nil {
+		return raw.String()
 	}
-
-	return tempQuantities
+	return value.String()
 }
 
-// 	// Print the calculated quantities
-// 	//fmt.Println("Calculated Quantities: ", tempQuantities)
-// 	return tempQuantities
-// }
-
-// 	for i := 0; i < len(edges); i++ {
-// 		edge := edges[i]
-// 		if (edge.OrderType == 1 && edge.Price < currentMarketPrice) || (edge.OrderType == 0 && edge.Price > currentMarketPrice) {
-// 			// Keep the valid edge
-// 			validEdges = append(validEdges, edge)
-// 			// fmt.Printf("  Valid Edge - OrderID: %s, Price: %.2f, Quantity: %.2f, OrderType: %d, MarketPrice: %.2f\n",
-// 			// 	edge.OrderID, edge.Price, edge.Quantity, edge.OrderType, currentMarketPrice)
-// 		} else {
-// 			// Remove the invalid edge
-// 			//fmt.Printf("  Invalid Edge - OrderID: %s, Price: %.2f, Quantity: %.2f, OrderType: %d, MarketPrice: %.2f (Removed)\n",
-// 			//edge.OrderID, edge.Price, edge.Quantity, edge.OrderType, currentMarketPrice)
-// 			// Shift the remaining edges to the left to remove the invalid edge
-// 			edges = append(edges[:i], edges[i+1:]...)
-// 			i-- // Decrease i to recheck the new element at the current index after removal
-// 		}
-// 	}
-
-// 	// Return only the valid edges
-// 	return validEdges
-// }
-
-// func main() {
-
-// 	graph := NewGraph()
-// 	graph.AddEdge("B", "C", 1, 2, 15, 1)
-// 	graph.AddEdge("C", "D", 2, 1, 20, 1)
-// 	graph.AddEdge("D", "E", 3, 1, 10, 1)
-// 	graph.AddEdge("E", "B", 4, 0.5, 12, 1)
-
-// 	// Detecting and printing the first cycle
-// 	cyclePath, validCycleEdges, orderIDs := graph.DetectValidCycle()
-
-// 	fmt.Println("Order IDs in the Cycle:", orderIDs)
-
-// 	if cyclePath != nil {
-// 		quantities := graph.calculateMinimumAdjustedQuantities(cyclePath, validCycleEdges)
-// 		fmt.Println("Order IDs in the Cycle:", quantities)
-// 	} else {
-// 		fmt.Println("No valid cycle detected.")
-// 	}
-// }
-
 // Replace with your contract address and ABI
 const (
 	contractAddress = "0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512"
 	hardhatNetwork  = "ws://127.0.0.1:8545/"
-)
 
-type Order struct {
-	UserAddress common.Address // Matches Solidity's `address`
-	OrderType   uint8          // Matches Solidity's `uint8` enum for `OrderType`
-	OrderID     uint64         // Matches Solidity's `uint64`
-	Price       *big.Int       // Matches Solidity's `uint256`
-	Quantity    *big.Int       // Matches Solidity's `uint256`
-	TokenPair0  common.Address // Matches Solidity's `address`
-	TokenPair1  common.Address // Matches Solidity's `address`
-}
+	// trailingStopsFile keeps the marks of trailing orders across restarts
+	trailingStopsFile = "trailing_stops.json"
 
-type Edge struct {
-	OrderID   uint64
-	Price     *big.Int
-	Quantity  *big.Int
-	OrderType uint8
-}
+	// orderOptionsFile is where owners register stop-limits, trailing orders and OCO groups by
+	// order ID, it is read on every event
+	orderOptionsFile = "order_options.json"
 
-// Graph structure with adjacency list storing lists of edges for each directed connection
-type Graph struct {
-	adjacencyList map[string]map[string][]Edge
-	visited       map[string]bool
-	recStack      map[string]bool
-}
+	// maxClearingRounds bounds the matchTrade batches sent for one event
+	maxClearingRounds = 32
+)
+
+// Order is the DEX.Order struct decoded from getAllOrders
+type Order = class.ChainOrder
 
 func loadABI(filename string) (abi.ABI, error) {
 	// Read the ABI JSON file
@@ -383,60 +118,81 @@ func matchOrder(parsedABI abi.ABI, client *ethclient.Client, orderIDList []uint6
 	return nil
 }
 
-func ProcessBatchOrder(orders []Order) ([]uint64, []*big.Int) {
-	graph := NewGraph()
-
-	for _, order := range orders {
-		graph.AddEdge(order.TokenPair0.Hex(), order.TokenPair1.Hex(), order.OrderID, order.Price, order.Quantity, order.OrderType)
+// submitMatch signs matchTrade once the verifier finds no require it would revert on, and reports
+// whether it was sent
+func submitMatch(parsedABI abi.ABI, verifier *class.Verifier, orderIDList []uint64, quantity []*big.Int) bool {
+	if violations := verifier.Verify(orderIDList, quantity); len(violations) > 0 {
+		for _, violation := range violations {
+			log.Printf("matchTrade %v would revert: %v", orderIDList, violation)
+		}
+		return false
 	}
 
-	cyclePath, validCycleEdges, orderIDs := graph.DetectValidCycle()
-	fmt.Println("Order IDs:", orderIDs)
+	matchOrder(parsedABI, client, orderIDList, quantity)
+	verifier.Apply(orderIDList, quantity)
+	return true
+}
 
-	if cyclePath != nil {
-		quantities := graph.calculateMinimumAdjustedQuantities(cyclePath, validCycleEdges)
-		return orderIDs, quantities
-	} else {
-		fmt.Println("No valid cycle detected.")
+// executeOrder matches a single triggered order and cancels its OCO siblings
+func executeOrder(parsedABI abi.ABI, verifier *class.Verifier, order Order) {
+	if oco.IsCancelled(c.OrderID(order.OrderID)) {
+		fmt.Println("cancelled by its OCO group -> skipping ", order.OrderID)
+		return
 	}
 
-	return []uint64{}, []*big.Int{}
-
+	if !submitMatch(parsedABI, verifier, []uint64{order.OrderID}, []*big.Int{order.Quantity}) { // ensure uint256 is correctly defined
+		return
+	}
+	cancelSiblings(order.OrderID)
 }
 
-// func processOrder(orders []Order) {
-// 	// Process and print the orders
-// 	graph := NewGraph()
-
-// 	for _, order := range orders {
-// 		fmt.Printf("Order: ID: %v, Type: %v, User: %s, Price: %v, Quantity: %v, TokenPair0: %s, TokenPair1: %s\n",
-// 			order.OrderID, order.OrderType, order.UserAddress.Hex(), order.Price, order.Quantity, order.TokenPair0.Hex(), order.TokenPair1.Hex())
-
-// 		oneEighteen := big.NewInt(1e18)
-// 		price := new(big.Float).SetInt(order.Price)
-// 		price.Quo(price, new(big.Float).SetInt(oneEighteen))
-
-// 		priceFloat64, _ := price.Float64()
+// cancelSiblings stops the keeper and the books from executing the OCO siblings of an executed
+// order. DEX.cancelOrder only accepts the owner so the siblings stay on chain until they cancel them
+func cancelSiblings(orderID uint64) {
+	for _, sibling := range oco.Filled(c.OrderID(orderID)) {
+		id := uint64(sibling)
+		triggers.Remove(id)
+		trailing.Remove(id)
+		registry.CancelOrder(id)
+		log.Printf("Order %v cancelled by OCO sibling %v, its owner must cancel it on chain to release the deposit", id, orderID)
+	}
+}
 
-// 		quantity := new(big.Float).SetInt(order.Quantity)
-// 		quantity.Quo(quantity, new(big.Float).SetInt(oneEighteen))
+// ProcessBatchOrder clears every ring the orders allow, at most maxClearingRounds batches. The
+// batches are sent to matchTrade in order
+func ProcessBatchOrder(orders []Order) []class.RingFill {
+	graph := class.NewRingGraph()
+	graph.SetOCOGroups(oco)
 
-// 		quantityFloat64, _ := quantity.Float64()
+	for _, order := range orders {
+		graph.AddOrder(order)
+	}
 
-// 		graph.AddEdge(order.TokenPair0.Hex(), order.TokenPair1.Hex(), int(order.OrderID), priceFloat64, quantityFloat64, int(order.OrderType))
-// 	}
+	batches := graph.Clear(maxClearingRounds)
+	for i, fill := range batches {
+		fmt.Printf("Batch %d: order IDs %v over %d laps\n", i, fill.GetOrderIDs(), fill.Laps)
+		logSurplus(fill.Orders, fill.Quantities)
+	}
 
-// 	cyclePath, validCycleEdges, orderIDs := graph.DetectValidCycle()
-// 	fmt.Println("Order IDs in the Cycle:", orderIDs)
+	if len(batches) == 0 {
+		fmt.Println("No valid cycle detected.")
+	}
+	return batches
+}
 
-// 	if cyclePath != nil {
-// 		quantities := graph.calculateMinimumAdjustedQuantities(cyclePath, validCycleEdges)
-// 		fmt.Println("Order IDs in the Cycle:", quantities)
-// 	} else {
-// 		fmt.Println("No valid cycle detected.")
-// 	}
+// logSurplus prints what the ring leaves over and which participant it is left on
+func logSurplus(ring []Order, quantities []*big.Int) {
+	surplus, err := class.SplitSurplus(ring, quantities)
+	if err != nil {
+		fmt.Println("Failed to split the ring surplus:", err)
+		return
+	}
 
-// }
+	fmt.Println("Ring surplus rate:", formatFixed(surplus.Rate))
+	for _, leg := range surplus.Legs {
+		fmt.Printf("Order %v of %v is paid %v of %v, %v more is delivered\n", leg.OrderID, leg.UserAddress.Hex(), leg.Paid, leg.Token.Hex(), leg.Surplus)
+	}
+}
 
 func GetMasterLP(client *ethclient.Client, contractAddress string, parsedABI abi.ABI) (common.Address, error) {
 	// Pack the call data for getMasterLP
@@ -470,6 +226,37 @@ func GetMasterLP(client *ethclient.Client, contractAddress string, parsedABI abi
 	return masterLPAddress, nil
 }
 
+// GetAmountOut quotes LiquidityPool.getAmountOut, what a swap of amountIn would pay out right now
+func GetAmountOut(amountIn *big.Int, tokenIn, tokenOut common.Address) (*big.Int, error) {
+	liquidityPoolAddress, err := GetLiquidityPool(tokenIn, tokenOut)
+	if err != nil {
+		return nil, err
+	}
+
+	callData, err := liquidityPoolABI.Pack("getAmountOut", amountIn, tokenIn, tokenOut)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack call data for getAmountOut: %v", err)
+	}
+
+	msg := ethereum.CallMsg{
+		To:   &liquidityPoolAddress,
+		Data: callData,
+	}
+
+	result, err := client.CallContract(context.Background(), msg, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call contract: %v", err)
+	}
+
+	var amountOut *big.Int
+	err = liquidityPoolABI.UnpackIntoInterface(&amountOut, "getAmountOut", result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack amount out: %v", err)
+	}
+
+	return amountOut, nil
+}
+
 func GetLiquidityPool(tokenPair0, tokenPair1 common.Address) (common.Address, error) {
 	// Pack the call data for getLP function
 	callData, err := MasterLPABI.Pack("getLP", tokenPair0, tokenPair1)
@@ -543,6 +330,19 @@ var (
 	MasterLPABI      abi.ABI
 	liquidityPoolABI abi.ABI
 	masterLPAddress  common.Address
+
+	// registry keeps an off-chain book for every pair with open orders
+	registry = class.NewOrderbookRegistry()
+
+	// triggers indexes the resting limit and stop orders of every market by trigger price
+	triggers = class.NewTriggerEngine()
+
+	// trailing keeps the high and low-water marks of trailing orders, loaded in main
+	trailing *class.TrailingStops
+
+	// oco links orders that cancel each other once one of them is executed on chain. The registry
+	// books never get it, their trades stay off-chain and must not cancel siblings that are still open
+	oco = class.NewOCOGroups()
 )
 
 // If a price doesn't exist for the pair, it generates and stores a new random price
@@ -580,6 +380,11 @@ func main() {
 		log.Fatalf("Failed to load ABI: %v", err)
 	}
 
+	trailing, err = class.NewTrailingStops(trailingStopsFile)
+	if err != nil {
+		log.Fatalf("Failed to load trailing stops: %v", err)
+	}
+
 	// Create a filter query for the OrderAdded event
 	query := ethereum.FilterQuery{
 		Addresses: []common.Address{common.HexToAddress(contractAddress)},
@@ -631,32 +436,91 @@ func main() {
 					continue
 				}
 
+				// every matchTrade is checked against the snapshot before it is signed
+				verifier := class.NewVerifier(orders, GetMarketPrice)
+
+				// orders cancelled by an OCO sibling stay on chain until their owner cancels them
+				oco.Sync(orders)
+				orders = oco.Exclude(orders)
+
+				bookTrades, err := registry.Sync(orders)
+				if err != nil {
+					log.Printf("Failed to sync order books: %v", err)
+				}
+				for pair, trades := range bookTrades {
+					log.Printf("Order book %v matched %d trades", pair, len(trades))
+				}
+
 				masterLPAddress, err = GetMasterLP(client, contractAddress, parsedABI)
 				if err != nil {
 					log.Fatalf("Error retrieving MasterLP address: %v", err)
 				}
 				fmt.Printf("MasterLP Address: %s\n", masterLPAddress.Hex())
 
-				var batchOrders []Order
+				options, err := class.LoadOrderOptions(orderOptionsFile)
+				if err != nil {
+					log.Printf("Failed to load order options: %v", err)
+				}
+				if err := options.Apply(orders, triggers, trailing, oco); err != nil {
+					log.Printf("Failed to apply order options: %v", err)
+				}
+
+				if err := trailing.Sync(orders); err != nil {
+					log.Printf("Failed to sync trailing stops: %v", err)
+				}
+				if err := triggers.Sync(trailing.Exclude(orders)); err != nil {
+					log.Printf("Failed to sync triggers: %v", err)
+				}
 
-				for _, order := range orders {
-					marketPrice := marketPrice(order.TokenPair0.Hex(), order.TokenPair1.Hex())
-					fmt.Println("MarketPrice is ", marketPrice)
+				// one price per market with waiting orders, only the orders it crosses are matched
+				for _, market := range triggers.GetMarkets() {
+					price := marketPrice(market.TokenIn.Hex(), market.TokenOut.Hex())
+					fmt.Println("MarketPrice of", market, "is", price)
 
-					if (order.OrderType == 1 && order.Price.Cmp(marketPrice) >= 0) || (order.OrderType == 2 && order.Price.Cmp(marketPrice) <= 0) {
+					for _, order := range triggers.Trigger(market, price) {
 						fmt.Println("valid order -> matching ", order.OrderID)
-						matchOrder(parsedABI, client, []uint64{order.OrderID}, []*big.Int{order.Quantity}) // ensure uint256 is correctly defined
-					} else {
-						fmt.Println("invalid order -> skipping ", order.OrderID)
-						batchOrders = append(batchOrders, order)
+						executeOrder(parsedABI, verifier, order)
+					}
+
+					// triggered stop-limits only execute while the pool pays their limit, re-quoted after every swap
+					quote := func(amountIn *big.Int) (*big.Int, error) {
+						return GetAmountOut(amountIn, market.TokenIn, market.TokenOut)
+					}
+					for {
+						order, ok, err := triggers.NextStopLimit(market, marketPrice(market.TokenIn.Hex(), market.TokenOut.Hex()), quote)
+						if err != nil {
+							log.Printf("Failed to check stop-limits of %v: %v", market, err)
+						}
+						if !ok {
+							break
+						}
+
+						fmt.Println("stop-limit within limit -> matching ", order.OrderID)
+						executeOrder(parsedABI, verifier, order)
 					}
 				}
 
-				orderIDs, quantities := ProcessBatchOrder(orders)
-				log.Println()
-				log.Println("quantities: ", quantities)
-				if len(orderIDs) != 0 {
-					matchOrder(parsedABI, client, orderIDs, quantities)
+				// trailing orders follow the best price and fire once it retraces past the trail
+				for _, market := range trailing.GetMarkets() {
+					fired, err := trailing.Update(market, marketPrice(market.TokenIn.Hex(), market.TokenOut.Hex()))
+					if err != nil {
+						log.Printf("Failed to update trailing stops of %v: %v", market, err)
+					}
+					for _, order := range fired {
+						fmt.Println("trailing order retraced -> matching ", order.OrderID)
+						executeOrder(parsedABI, verifier, order)
+					}
+				}
+
+				for _, batch := range ProcessBatchOrder(orders) {
+					log.Println()
+					log.Println("quantities: ", batch.Quantities)
+					if !submitMatch(parsedABI, verifier, batch.GetOrderIDs(), batch.Quantities) {
+						continue
+					}
+					for _, orderID := range batch.GetOrderIDs() {
+						cancelSiblings(orderID)
+					}
 				}
 				// processOrder(orders)
 
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"orderbook.com/m/class"
+)
+
+func TestElementaryCycles(t *testing.T) {
+	adjacency := map[string][]string{
+		"A": {"B", "C"},
+		"B": {"C", "A"},
+		"C": {"A"},
+		"D": {"A"},
+	}
+
+	want := [][]string{
+		{"A", "B"},
+		{"A", "B", "C"},
+		{"A", "C"},
+	}
+	for run := 0; run < 20; run++ {
+		cycles := class.ElementaryCycles(adjacency, 0)
+		if !reflect.DeepEqual(cycles, want) {
+			t.Fatalf("Run %d: expected cycles %v, got %v", run, want, cycles)
+		}
+	}
+}
+
+func TestElementaryCyclesMaxLength(t *testing.T) {
+	adjacency := map[string][]string{
+		"A": {"B", "C"},
+		"B": {"C", "A"},
+		"C": {"A"},
+	}
+
+	cycles := class.ElementaryCycles(adjacency, 2)
+	want := [][]string{{"A", "B"}, {"A", "C"}}
+	if !reflect.DeepEqual(cycles, want) {
+		t.Errorf("Expected cycles %v, got %v", want, cycles)
+	}
+}
+
+func TestElementaryCyclesComplete(t *testing.T) {
+	// a complete directed graph on n vertices has sum over k of C(n,k)*(k-1)! cycles of two or more
+	vertices := []string{"A", "B", "C", "D", "E"}
+	adjacency := make(map[string][]string)
+	for _, from := range vertices {
+		for _, to := range vertices {
+			if from != to {
+				adjacency[from] = append(adjacency[from], to)
+			}
+		}
+	}
+	adjacency["A"] = append(adjacency["A"], "A")
+
+	cycles := class.ElementaryCycles(adjacency, 0)
+	if len(cycles) != 84 {
+		t.Errorf("Expected 84 cycles, got %d", len(cycles))
+	}
+
+	seen := make(map[string]bool)
+	for _, cycle := range cycles {
+		visited := make(map[string]bool)
+		for _, vertex := range cycle {
+			if visited[vertex] {
+				t.Fatalf("Cycle %v visits %v twice", cycle, vertex)
+			}
+			visited[vertex] = true
+		}
+
+		key := ""
+		for _, vertex := range cycle {
+			key += vertex
+		}
+		if seen[key] {
+			t.Fatalf("Cycle %v enumerated twice", cycle)
+		}
+		seen[key] = true
+	}
+
+	if short := class.ElementaryCycles(adjacency, 3); len(short) != 30 {
+		t.Errorf("Expected 30 cycles of at most three tokens, got %d", len(short))
+	}
+}
+
+func TestElementaryCyclesAcyclic(t *testing.T) {
+	adjacency := map[string][]string{
+		"A": {"B"},
+		"B": {"C"},
+	}
+	if cycles := class.ElementaryCycles(adjacency, 0); len(cycles) != 0 {
+		t.Errorf("Expected no cycles, got %v", cycles)
+	}
+}
+
+func TestScoreCycle(t *testing.T) {
+	score, err := class.ScoreCycle([]*big.Int{ether("2"), ether("0.4")})
+	if err != nil {
+		t.Fatalf("ScoreCycle failed: %v", err)
+	}
+	if score.Cmp(ether("0.2")) != 0 {
+		t.Errorf("Expected a score of 0.2 ether, got %v", score)
+	}
+
+	score, err = class.ScoreCycle([]*big.Int{ether("2"), ether("0.5"), ether("1.1")})
+	if err != nil {
+		t.Fatalf("ScoreCycle failed: %v", err)
+	}
+	if score.Cmp(new(big.Int).Neg(ether("0.1"))) != 0 {
+		t.Errorf("Expected a score of -0.1 ether, got %v", score)
+	}
+
+	// 1/3 * 3 rounds up to more than one, the ring cannot pay for the floor of DEX._multiply
+	third := new(big.Int).Div(ether("1"), big.NewInt(3))
+	score, err = class.ScoreCycle([]*big.Int{new(big.Int).Add(third, big.NewInt(1)), ether("3")})
+	if err != nil {
+		t.Fatalf("ScoreCycle failed: %v", err)
+	}
+	if score.Sign() >= 0 {
+		t.Errorf("Expected a negative score, got %v", score)
+	}
+
+	if _, err := class.ScoreCycle([]*big.Int{ether("1")}); err == nil {
+		t.Errorf("Expected an error for a single leg")
+	}
+}
@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"orderbook.com/m/c"
+	"orderbook.com/m/class"
+)
+
+func TestEngineCommands(t *testing.T) {
+	engine := class.NewEngine(class.NewOrderbook(), 0)
+	defer engine.Stop()
+
+	if engine.Snapshot().Sequence != 0 || engine.Snapshot().Size != 0 {
+		t.Fatalf("Expected an empty snapshot at sequence 0, got %+v", engine.Snapshot())
+	}
+
+	first := engine.Submit(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(100), c.Quantity(10)))
+	second := engine.Submit(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.BUY, c.Price(100), c.Quantity(4)))
+
+	if result := first.Wait(); result.Err != nil || result.Sequence != 1 {
+		t.Errorf("Expected sequence 1, got %+v", result)
+	}
+	result := second.Wait()
+	if result.Err != nil || result.Sequence != 2 || len(result.Trades) != 1 {
+		t.Errorf("Expected sequence 2 with one trade, got %+v", result)
+	}
+
+	// a rejected command leaves the book and the sequence untouched
+	if result := engine.Cancel(c.OrderID(2)).Wait(); result.Err == nil || result.Sequence != 0 {
+		t.Errorf("Expected cancelling a filled order to fail without a sequence, got %+v", result)
+	}
+
+	if result := engine.Modify(c.OrderID(1), c.SELL, c.Price(100), c.Quantity(3)).Wait(); result.Err != nil || result.Sequence != 3 {
+		t.Errorf("Expected modify at sequence 3, got %+v", result)
+	}
+	if result := engine.Prune().Wait(); result.Err != nil || result.Sequence != 0 {
+		t.Errorf("Expected a prune without expired orders not to change the book, got %+v", result)
+	}
+
+	snapshot := engine.Snapshot()
+	asks := snapshot.LevelInfos.GetAsks()
+	if snapshot.Sequence != 3 || snapshot.Size != 1 || len(asks) != 1 || asks[0].Quantity != 3 {
+		t.Errorf("Expected one ask of 3 at sequence 3, got %+v", snapshot)
+	}
+	if engine.GetSequence() != 3 {
+		t.Errorf("Expected sequence 3, got %v", engine.GetSequence())
+	}
+}
+
+func TestEngineStop(t *testing.T) {
+	engine := class.NewEngine(class.NewOrderbook(), 0)
+
+	pending := engine.Submit(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(100), c.Quantity(10)))
+	engine.Stop()
+	engine.Stop()
+
+	// queued commands are still applied before the writer exits
+	if result := pending.Wait(); result.Err != nil || result.Sequence != 1 {
+		t.Errorf("Expected the queued order to be applied, got %+v", result)
+	}
+	if result := engine.Submit(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(100), c.Quantity(10))).Wait(); !errors.Is(result.Err, class.ErrEngineStopped) {
+		t.Errorf("Expected ErrEngineStopped, got %+v", result)
+	}
+}
+
+func TestEngineFailedCommandChangesBook(t *testing.T) {
+	clock := newFakeClock(sessionStart)
+	book := class.NewOrderbook()
+	book.SetClock(clock)
+	engine := class.NewEngine(book, 0)
+	defer engine.Stop()
+
+	engine.Submit(class.NewGoodTillDateOrder(c.OrderID(1), c.SELL, c.Price(100), c.Quantity(5), sessionStart.Add(time.Hour)))
+	engine.Submit(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(101), c.Quantity(5))).Wait()
+
+	// the FillOrKill is rejected, but only after order 1 expired out of the book
+	clock.Advance(time.Hour)
+	result := engine.Submit(class.NewOrder(c.FillOrKill, c.OrderID(3), c.BUY, c.Price(100), c.Quantity(5))).Wait()
+	if result.Err == nil || result.Sequence != 3 {
+		t.Errorf("Expected the rejected order to get sequence 3 for the prune, got %+v", result)
+	}
+	if snapshot := engine.Snapshot(); snapshot.Sequence != 3 || snapshot.Size != 1 {
+		t.Errorf("Expected the snapshot to show the pruned book at sequence 3, got %+v", snapshot)
+	}
+
+	// a rejected modify leaves the book as it was
+	result = engine.Modify(c.OrderID(2), c.SELL, c.Price(101), c.Quantity(0)).Wait()
+	if result.Err == nil || result.Sequence != 0 || engine.Snapshot().Size != 1 {
+		t.Errorf("Expected the rejected modify not to change the book, got %+v", result)
+	}
+}
+
+// TestEngineConcurrent is meant to be run with -race, writers and readers share only the engine
+func TestEngineConcurrent(t *testing.T) {
+	const writers, ordersPerWriter = 8, 200
+
+	engine := class.NewEngine(class.NewOrderbook(), 5)
+	stop := make(chan struct{})
+
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+
+			var last uint64
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				snapshot := engine.Snapshot()
+				if snapshot.Sequence < last {
+					t.Errorf("Expected sequence to never go back, got %v after %v", snapshot.Sequence, last)
+					return
+				}
+				last = snapshot.Sequence
+
+				bids, asks := snapshot.LevelInfos.GetBids(), snapshot.LevelInfos.GetAsks()
+				if len(bids) > 0 && len(asks) > 0 && bids[0].Price >= asks[0].Price {
+					t.Errorf("Expected the snapshot never to be crossed, got %v and %v", bids[0], asks[0])
+					return
+				}
+			}
+		}()
+	}
+
+	var mu sync.Mutex
+	sequences := make(map[uint64]bool)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < ordersPerWriter; i++ {
+				orderID := c.OrderID(w*ordersPerWriter + i + 1)
+				side := c.Side(i % 2)
+				price := c.Price(95 + i%10)
+
+				result := engine.Submit(class.NewOrder(c.GoodTillCancel, orderID, side, price, c.Quantity(1+i%3))).Wait()
+				if result.Err != nil {
+					t.Errorf("Expected no error, got %v", result.Err)
+					return
+				}
+
+				mu.Lock()
+				if sequences[result.Sequence] {
+					t.Errorf("Expected unique sequence numbers, %v was handed out twice", result.Sequence)
+				}
+				sequences[result.Sequence] = true
+				mu.Unlock()
+
+				if i%5 == 0 {
+					engine.Cancel(orderID)
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+	engine.Stop()
+
+	if len(sequences) != writers*ordersPerWriter {
+		t.Errorf("Expected %v sequenced submits, got %v", writers*ordersPerWriter, len(sequences))
+	}
+	if engine.Snapshot().Sequence != engine.GetSequence() {
+		t.Errorf("Expected the last snapshot at sequence %v, got %v", engine.GetSequence(), engine.Snapshot().Sequence)
+	}
+}
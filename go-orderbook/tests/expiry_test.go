@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"orderbook.com/m/c"
+	"orderbook.com/m/class"
+)
+
+// fakeClock only moves when the test advances it
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	f.waiters = append(f.waiters, fakeWaiter{deadline: f.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward and fires every waiter whose deadline passed
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+	remaining := f.waiters[:0]
+	for _, w := range f.waiters {
+		if !w.deadline.After(f.now) {
+			w.ch <- f.now
+		} else {
+			remaining = append(remaining, w)
+		}
+	}
+	f.waiters = remaining
+}
+
+// waitForWaiter blocks until something is waiting on the clock
+func (f *fakeClock) waitForWaiter(t *testing.T) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		f.mu.Lock()
+		n := len(f.waiters)
+		f.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("Expected the pruner to wait on the clock")
+}
+
+var sessionStart = time.Date(2024, 11, 4, 9, 0, 0, 0, time.UTC)
+
+func TestGoodTillDateExpiry(t *testing.T) {
+	clock := newFakeClock(sessionStart)
+	ob := class.NewOrderbook()
+	ob.SetClock(clock)
+
+	_, err := ob.AddOrder(class.NewGoodTillDateOrder(c.OrderID(1), c.BUY, c.Price(50), c.Quantity(5), sessionStart))
+	if err == nil {
+		t.Error("Expected an already expired GoodTillDate order to be rejected, got none")
+	}
+	_, err = ob.AddOrder(class.NewOrder(c.GoodTillDate, c.OrderID(2), c.BUY, c.Price(50), c.Quantity(5)))
+	if err == nil {
+		t.Error("Expected a GoodTillDate order without expiry to be rejected, got none")
+	}
+
+	ob.AddOrder(class.NewGoodTillDateOrder(c.OrderID(3), c.BUY, c.Price(50), c.Quantity(5), sessionStart.Add(time.Hour)))
+	ob.AddOrder(class.NewGoodTillDateOrder(c.OrderID(4), c.BUY, c.Price(49), c.Quantity(5), sessionStart.Add(2*time.Hour)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(5), c.BUY, c.Price(48), c.Quantity(5)))
+
+	if events := ob.PruneExpiredOrders(); len(events) != 0 {
+		t.Errorf("Expected nothing to expire yet, got %v", events)
+	}
+
+	clock.Advance(time.Hour)
+	events := ob.PruneExpiredOrders()
+	if len(events) != 1 || events[0].OrderId != 3 || events[0].RemainingQuantity != 5 {
+		t.Fatalf("Expected order 3 to expire, got %v", events)
+	}
+	if ob.Size() != 2 {
+		t.Errorf("Expected 2 resting orders, got %v", ob.Size())
+	}
+
+	// an expired order that was not pruned yet must not trade
+	clock.Advance(time.Hour)
+	trades, _ := ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(6), c.SELL, c.Price(49), c.Quantity(5)))
+	if len(trades) != 0 {
+		t.Errorf("Expected no trade against the expired order 4, got %v", trades)
+	}
+	events = ob.PruneExpiredOrders()
+	if len(events) != 1 || events[0].OrderId != 4 {
+		t.Errorf("Expected the expiry of order 4 to still be reported, got %v", events)
+	}
+}
+
+func TestGoodForDayExpiry(t *testing.T) {
+	clock := newFakeClock(sessionStart)
+	ob := class.NewOrderbook()
+	ob.SetClock(clock)
+
+	if err := ob.SetSessionCutoff(25 * time.Hour); err == nil {
+		t.Error("Expected a cutoff longer than a day to be rejected, got none")
+	}
+	ob.SetSessionCutoff(17 * time.Hour)
+
+	order := class.NewOrder(c.GoodForDay, c.OrderID(1), c.SELL, c.Price(50), c.Quantity(5))
+	ob.AddOrder(order)
+	if expected := sessionStart.Add(8 * time.Hour); !order.GetExpiry().Equal(expected) {
+		t.Errorf("Expected expiry at %v, got %v", expected, order.GetExpiry())
+	}
+
+	// modifying keeps the original session
+	clock.Advance(time.Hour)
+	ob.ModifyOrder(c.OrderID(1), c.SELL, c.Price(51), c.Quantity(5))
+
+	clock.Advance(7 * time.Hour)
+	events := ob.PruneExpiredOrders()
+	if len(events) != 1 || events[0].OrderId != 1 || events[0].Price != 51 {
+		t.Fatalf("Expected modified order 1 to expire at the cutoff, got %v", events)
+	}
+
+	// after the cutoff GoodForDay orders belong to the next session
+	order = class.NewOrder(c.GoodForDay, c.OrderID(2), c.SELL, c.Price(50), c.Quantity(5))
+	ob.AddOrder(order)
+	if expected := sessionStart.Add(32 * time.Hour); !order.GetExpiry().Equal(expected) {
+		t.Errorf("Expected expiry at %v, got %v", expected, order.GetExpiry())
+	}
+}
+
+func TestModifyExpiredGoodForDay(t *testing.T) {
+	clock := newFakeClock(sessionStart)
+	ob := class.NewOrderbook()
+	ob.SetClock(clock)
+	ob.SetSessionCutoff(16 * time.Hour)
+
+	clock.Advance(time.Hour)
+	ob.AddOrder(class.NewOrder(c.GoodForDay, c.OrderID(1), c.SELL, c.Price(50), c.Quantity(5)))
+
+	// 18:00 is past the cutoff of the session the order was placed in, it must not move to the next one
+	clock.Advance(8 * time.Hour)
+	if _, err := ob.ModifyOrder(c.OrderID(1), c.SELL, c.Price(51), c.Quantity(10)); err == nil {
+		t.Error("Expected modifying an expired GoodForDay order to fail, got none")
+	}
+	if ob.Size() != 0 {
+		t.Errorf("Expected the expired order to leave the book, got %v resting", ob.Size())
+	}
+	events := ob.PruneExpiredOrders()
+	if len(events) != 1 || events[0].OrderId != 1 || events[0].Price != 50 {
+		t.Errorf("Expected the expiry of order 1 to be reported, got %v", events)
+	}
+}
+
+func TestPruner(t *testing.T) {
+	clock := newFakeClock(sessionStart)
+	ob := class.NewOrderbook()
+	ob.SetClock(clock)
+
+	ob.AddOrder(class.NewGoodTillDateOrder(c.OrderID(1), c.BUY, c.Price(50), c.Quantity(5), sessionStart.Add(time.Minute)))
+	ob.AddOrder(class.NewGoodTillDateOrder(c.OrderID(2), c.BUY, c.Price(49), c.Quantity(5), sessionStart.Add(time.Minute)))
+	ob.AddOrder(class.NewGoodTillDateOrder(c.OrderID(3), c.BUY, c.Price(48), c.Quantity(5), sessionStart.Add(time.Hour)))
+
+	// a filled order must not be reported as expired
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(4), c.SELL, c.Price(50), c.Quantity(5)))
+
+	events, stop := ob.StartPruner(time.Minute)
+
+	clock.waitForWaiter(t)
+	clock.Advance(time.Minute)
+
+	select {
+	case event := <-events:
+		if event.OrderId != 2 {
+			t.Errorf("Expected order 2 to expire, got %v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected an expiry event")
+	}
+
+	stop()
+	if _, ok := <-events; ok {
+		t.Error("Expected the event channel to be closed after stop")
+	}
+	if ob.Size() != 1 {
+		t.Errorf("Expected only order 3 to rest, got %v orders", ob.Size())
+	}
+}
@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"errors"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"orderbook.com/m/fixed"
+)
+
+func TestMulDivRounding(t *testing.T) {
+	tests := []struct {
+		x, y, denominator string
+		floor, ceil       string
+	}{
+		{"1500000000000000000", "3000000000000000000", "1000000000000000000", "4500000000000000000", "4500000000000000000"},
+		{"1", "1", "1000000000000000000", "0", "1"},
+		{"1000000000000000000", "1", "3", "333333333333333333", "333333333333333334"},
+		{"0", "7", "3", "0", "0"},
+		// the intermediate product needs 512 bits like in PRBMath.mulDiv
+		{
+			"115792089237316195423570985008687907853269984665640564039457584007913129639935",
+			"115792089237316195423570985008687907853269984665640564039457584007913129639935",
+			"115792089237316195423570985008687907853269984665640564039457584007913129639935",
+			"115792089237316195423570985008687907853269984665640564039457584007913129639935",
+			"115792089237316195423570985008687907853269984665640564039457584007913129639935",
+		},
+	}
+
+	for _, tt := range tests {
+		floor, err := fixed.MulDiv(bigInt(tt.x), bigInt(tt.y), bigInt(tt.denominator), fixed.Floor)
+		if err != nil || floor.String() != tt.floor {
+			t.Errorf("Expected floor %v * %v / %v = %v, got %v (%v)", tt.x, tt.y, tt.denominator, tt.floor, floor, err)
+		}
+		ceil, err := fixed.MulDiv(bigInt(tt.x), bigInt(tt.y), bigInt(tt.denominator), fixed.Ceil)
+		if err != nil || ceil.String() != tt.ceil {
+			t.Errorf("Expected ceil %v * %v / %v = %v, got %v (%v)", tt.x, tt.y, tt.denominator, tt.ceil, ceil, err)
+		}
+	}
+}
+
+func TestMulDivErrors(t *testing.T) {
+	maxUint256 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+	if _, err := fixed.MulDiv(big.NewInt(1), big.NewInt(1), big.NewInt(0), fixed.Floor); !errors.Is(err, fixed.ErrDivisionByZero) {
+		t.Errorf("Expected division by zero, got %v", err)
+	}
+	if _, err := fixed.MulDiv(maxUint256, big.NewInt(2), big.NewInt(1), fixed.Floor); !errors.Is(err, fixed.ErrOverflow) {
+		t.Errorf("Expected overflow, got %v", err)
+	}
+	if _, err := fixed.MulDiv(maxUint256, big.NewInt(1), big.NewInt(1), fixed.Ceil); err != nil {
+		t.Errorf("Expected max uint256 to fit, got %v", err)
+	}
+	if _, err := fixed.Mul(big.NewInt(-1), big.NewInt(1), fixed.Floor); !errors.Is(err, fixed.ErrOutOfRange) {
+		t.Errorf("Expected negative operand to be out of range, got %v", err)
+	}
+	if _, err := fixed.Mul(new(big.Int).Add(maxUint256, big.NewInt(1)), big.NewInt(1), fixed.Floor); !errors.Is(err, fixed.ErrOutOfRange) {
+		t.Errorf("Expected 2^256 to be out of range, got %v", err)
+	}
+}
+
+func TestMulDivMatchesRational(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	bound := new(big.Int).Lsh(big.NewInt(1), 128)
+
+	for i := 0; i < 1000; i++ {
+		x := new(big.Int).Rand(random, bound)
+		y := new(big.Int).Rand(random, bound)
+		denominator := new(big.Int).Add(new(big.Int).Rand(random, bound), big.NewInt(1))
+
+		floor, err := fixed.MulDiv(x, y, denominator, fixed.Floor)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		ceil, _ := fixed.MulDiv(x, y, denominator, fixed.Ceil)
+
+		// floor * d <= x * y < (floor + 1) * d and ceil is floor plus one unless exact
+		product := new(big.Int).Mul(x, y)
+		low := new(big.Int).Mul(floor, denominator)
+		high := new(big.Int).Add(low, denominator)
+		if low.Cmp(product) > 0 || high.Cmp(product) <= 0 {
+			t.Fatalf("Expected floor of %v * %v / %v, got %v", x, y, denominator, floor)
+		}
+
+		expectedCeil := new(big.Int).Set(floor)
+		if low.Cmp(product) != 0 {
+			expectedCeil.Add(expectedCeil, big.NewInt(1))
+		}
+		if ceil.Cmp(expectedCeil) != 0 {
+			t.Fatalf("Expected ceil %v, got %v", expectedCeil, ceil)
+		}
+	}
+}
+
+func TestDivRoundTrip(t *testing.T) {
+	// the smallest start quantity whose payout covers the end quantity
+	price := ether("0.3")
+	end := ether("1")
+
+	start, err := fixed.Div(end, price, fixed.Ceil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	payout, _ := fixed.Mul(start, price, fixed.Floor)
+	if payout.Cmp(end) < 0 {
+		t.Errorf("Expected payout of %v to cover %v, got %v", start, end, payout)
+	}
+
+	start, _ = fixed.Div(end, price, fixed.Floor)
+	payout, _ = fixed.Mul(start, price, fixed.Floor)
+	if payout.Cmp(end) > 0 {
+		t.Errorf("Expected payout of %v not to exceed %v, got %v", start, end, payout)
+	}
+}
+
+func TestUD60x18(t *testing.T) {
+	x, err := fixed.Parse("1.5")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if x.Raw().String() != "1500000000000000000" || x.String() != "1.5" || x.Float64() != 1.5 {
+		t.Errorf("Expected 1.5, got raw %v string %v float %v", x.Raw(), x.String(), x.Float64())
+	}
+
+	product, _ := x.Mul(fixed.FromInt(3), fixed.Floor)
+	if product.String() != "4.5" {
+		t.Errorf("Expected 4.5, got %v", product)
+	}
+
+	third, _ := fixed.FromInt(1).Div(fixed.FromInt(3), fixed.Ceil)
+	if third.String() != "0.333333333333333334" {
+		t.Errorf("Expected 0.333333333333333334, got %v", third)
+	}
+	if third.Cmp(fixed.FromInt(1)) >= 0 || fixed.FromInt(0).Cmp(fixed.UD60x18{}) != 0 || !(fixed.UD60x18{}).IsZero() {
+		t.Errorf("Expected comparisons to follow the raw values")
+	}
+
+	if _, err := fixed.Parse("0.0000000000000000001"); err == nil {
+		t.Errorf("Expected more than 18 decimals to be rejected")
+	}
+	if _, err := fixed.Parse("abc"); err == nil {
+		t.Errorf("Expected a non number to be rejected")
+	}
+}
+
+func bigInt(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 10)
+	return n
+}
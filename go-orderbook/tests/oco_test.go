@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"orderbook.com/m/c"
+	"orderbook.com/m/class"
+)
+
+func TestOCOGroups(t *testing.T) {
+	groups := class.NewOCOGroups()
+
+	if _, err := groups.Link(1); err == nil {
+		t.Errorf("Expected a group of one order to be rejected")
+	}
+	if _, err := groups.Link(1, 2); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := groups.Link(2, 3); err == nil {
+		t.Errorf("Expected an order to be in one group only")
+	}
+	if _, err := groups.Link(4, 5, 6); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if siblings := groups.Filled(1); fmt.Sprint(siblings) != "[2]" {
+		t.Errorf("Expected order 2 to be cancelled, got %v", siblings)
+	}
+	if !groups.IsCancelled(2) || groups.Filled(2) != nil {
+		t.Errorf("Expected order 2 to be cancelled and out of any group")
+	}
+
+	// the owner cancelling one leg on chain leaves the others linked
+	chain := []class.ChainOrder{{OrderID: 2}, {OrderID: 5}, {OrderID: 6}}
+	groups.Sync(chain)
+	if siblings := groups.GetSiblings(5); fmt.Sprint(siblings) != "[6]" {
+		t.Errorf("Expected 5 and 6 to stay linked, got %v", siblings)
+	}
+	if live := groups.Exclude(chain); !equalIDs(triggerIDs(live), []uint64{5, 6}) {
+		t.Errorf("Expected the cancelled order to be excluded, got %v", triggerIDs(live))
+	}
+
+	// once the cancelled sibling is gone from the chain it is forgotten
+	groups.Sync(chain[1:])
+	if groups.IsCancelled(2) {
+		t.Errorf("Expected order 2 to be forgotten")
+	}
+
+	groups.Unlink(5)
+	if groups.GetSiblings(6) != nil {
+		t.Errorf("Expected a group of one to be dissolved")
+	}
+}
+
+func TestOCOInBook(t *testing.T) {
+	ob := class.NewOrderbook()
+	groups := class.NewOCOGroups()
+	ob.SetOCOGroups(groups)
+
+	// a take-profit and a stop-like exit on the same position, both selling
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(110), c.Quantity(10)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(111), c.Quantity(10)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.SELL, c.Price(112), c.Quantity(10)))
+	groups.Link(1, 2)
+
+	// a partial fill of 1 is enough to cancel 2, the sweep goes on to 3 instead
+	trades, _ := ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(4), c.BUY, c.Price(112), c.Quantity(15)))
+	if len(trades) != 2 || trades[0].GetMakerOrderID() != 1 || trades[1].GetMakerOrderID() != 3 {
+		t.Fatalf("Expected trades against 1 and 3, got %v", trades)
+	}
+	if _, ok := ob.GetOrder(c.OrderID(2)); ok {
+		t.Errorf("Expected order 2 to be cancelled by its sibling")
+	}
+	if !groups.IsCancelled(2) {
+		t.Errorf("Expected the groups to see order 2 as cancelled")
+	}
+
+	// the registry links the books it creates
+	registry := class.NewOrderbookRegistry()
+	registry.SetOCOGroups(groups)
+	groups.Link(10, 11)
+	registry.AddChainOrder(class.ChainOrder{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 10, Price: ether("2"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh})
+	registry.AddChainOrder(class.ChainOrder{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 11, Price: ether("3"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh})
+	registry.AddChainOrder(class.ChainOrder{UserAddress: bob, OrderType: class.ChainLimit, OrderID: 12, Price: ether("0.5"), Quantity: ether("1"), TokenPair0: tokenHigh, TokenPair1: tokenLow})
+
+	book := registry.GetOrderbook(tokenLow, tokenHigh)
+	if _, ok := book.GetOrder(c.OrderID(11)); ok {
+		t.Errorf("Expected order 11 to be cancelled once order 10 traded")
+	}
+}
+
+func TestOCOFillOrKill(t *testing.T) {
+	ob := class.NewOrderbook()
+	groups := class.NewOCOGroups()
+	ob.SetOCOGroups(groups)
+
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(50), c.Quantity(5)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(51), c.Quantity(5)))
+	groups.Link(1, 2)
+
+	// trading against 1 cancels 2, so only 5 of the 10 can be filled
+	trades, err := ob.AddOrder(class.NewOrder(c.FillOrKill, c.OrderID(3), c.BUY, c.Price(51), c.Quantity(10)))
+	if err == nil || len(trades) != 0 {
+		t.Fatalf("Expected the FillOrKill to be rejected, got %v %v", trades, err)
+	}
+	if ob.Size() != 2 || groups.IsCancelled(2) {
+		t.Errorf("Expected the book and the group to be untouched, got %v orders", ob.Size())
+	}
+
+	trades, err = ob.AddOrder(class.NewOrder(c.FillOrKill, c.OrderID(4), c.BUY, c.Price(51), c.Quantity(5)))
+	if err != nil || len(trades) != 1 || trades[0].GetAskTrade().OrderId != 1 {
+		t.Fatalf("Expected the FillOrKill to trade with order 1, got %v %v", trades, err)
+	}
+	if ob.Size() != 0 {
+		t.Errorf("Expected order 2 to be cancelled and nothing to rest, got %v orders", ob.Size())
+	}
+}
+
+func TestOCOKeeperGroupsStayOffBooks(t *testing.T) {
+	// the keeper links 10 and 11 but the books trade off-chain with their own groups
+	keeper := class.NewOCOGroups()
+	keeper.Link(10, 11)
+
+	registry := class.NewOrderbookRegistry()
+	registry.Sync([]class.ChainOrder{
+		{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 10, Price: ether("2"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		{UserAddress: alice, OrderType: class.ChainStop, OrderID: 11, Price: ether("3"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		{UserAddress: bob, OrderType: class.ChainLimit, OrderID: 12, Price: ether("0.5"), Quantity: ether("1"), TokenPair0: tokenHigh, TokenPair1: tokenLow},
+	})
+
+	if keeper.IsCancelled(11) {
+		t.Errorf("Expected an off-chain trade of order 10 to leave its stop 11 open for the keeper")
+	}
+	if siblings := keeper.GetSiblings(10); len(siblings) != 1 || siblings[0] != 11 {
+		t.Errorf("Expected orders 10 and 11 to stay linked, got %v", siblings)
+	}
+}
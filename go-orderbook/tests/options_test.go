@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"orderbook.com/m/class"
+)
+
+func TestOrderOptionsStopLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "order_options.json")
+
+	options, err := class.LoadOrderOptions(path)
+	if err != nil || len(options.StopLimits) != 0 {
+		t.Fatalf("Expected a missing file to hold no options, got %+v %v", options, err)
+	}
+
+	data := `{"stopLimits": [
+		{"orderId": 1, "limitPrice": 800000000000000000},
+		{"orderId": 2, "limitPrice": 900000000000000000},
+		{"orderId": 9, "limitPrice": 700000000000000000}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	options, err = class.LoadOrderOptions(path)
+	if err != nil || len(options.StopLimits) != 3 {
+		t.Fatalf("Expected three stop-limits, got %+v %v", options, err)
+	}
+
+	orders := []class.ChainOrder{
+		{UserAddress: alice, OrderType: class.ChainStop, OrderID: 1, Price: ether("1"), Quantity: ether("10"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		{UserAddress: bob, OrderType: class.ChainLimit, OrderID: 2, Price: ether("1"), Quantity: ether("10"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+	}
+
+	// order 2 is a limit and cannot be a stop-limit, order 9 waits until it is open
+	te := class.NewTriggerEngine()
+	if err := options.Apply(orders, te, trailingStops(t), class.NewOCOGroups()); err == nil {
+		t.Errorf("Expected the option of limit order 2 to be reported")
+	}
+	if limitPrice, ok := te.GetStopLimit(1); !ok || limitPrice.Cmp(ether("0.8")) != 0 {
+		t.Errorf("Expected order 1 to be a stop-limit at 0.8, got %v %v", limitPrice, ok)
+	}
+	if _, ok := te.GetStopLimit(2); ok {
+		t.Errorf("Expected order 2 to stay a plain limit")
+	}
+	if _, ok := te.GetStopLimit(9); ok {
+		t.Errorf("Expected order 9 to wait for its order")
+	}
+
+	if err := te.Sync(orders); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := options.Apply(orders[:1], te, trailingStops(t), class.NewOCOGroups()); err != nil {
+		t.Errorf("Expected applying the options again to be a no-op, got %v", err)
+	}
+	if _, ok := te.GetStopLimit(1); !ok {
+		t.Errorf("Expected order 1 to stay a stop-limit")
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := class.LoadOrderOptions(path); err == nil {
+		t.Errorf("Expected a broken file to be reported")
+	}
+}
+
+func trailingStops(t *testing.T) *class.TrailingStops {
+	ts, err := class.NewTrailingStops("")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return ts
+}
+
+func TestOrderOptionsTrailing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "order_options.json")
+	data := `{"trailing": [
+		{"orderId": 1, "trail": {"amount": 500000000000000000}},
+		{"orderId": 3, "trail": {"bps": 200}}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	options, err := class.LoadOrderOptions(path)
+	if err != nil || len(options.Trailing) != 2 {
+		t.Fatalf("Expected two trailing orders, got %+v %v", options, err)
+	}
+
+	stop := class.ChainOrder{UserAddress: alice, OrderType: class.ChainStop, OrderID: 1, Price: ether("5"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh}
+	market := class.Market{TokenIn: tokenLow, TokenOut: tokenHigh}
+	ts := trailingStops(t)
+	if err := options.Apply([]class.ChainOrder{stop}, class.NewTriggerEngine(), ts, class.NewOCOGroups()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := ts.GetTrailingStop(3); ok {
+		t.Errorf("Expected order 3 to wait for its order")
+	}
+
+	// applying the same options again keeps the mark the stop followed
+	ts.Update(market, ether("3"))
+	if err := options.Apply([]class.ChainOrder{stop}, class.NewTriggerEngine(), ts, class.NewOCOGroups()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	got, ok := ts.GetTrailingStop(1)
+	if !ok || got.Mark == nil || got.Mark.Cmp(ether("3")) != 0 || got.Trail.Amount.Cmp(ether("0.5")) != 0 {
+		t.Fatalf("Expected order 1 to trail by 0.5 from mark 3, got %+v", got)
+	}
+
+	fired, err := ts.Update(market, ether("2.5"))
+	if err != nil || !equalIDs(triggerIDs(fired), []uint64{1}) {
+		t.Errorf("Expected order 1 to fire at 2.5, got %v %v", triggerIDs(fired), err)
+	}
+
+	marketOrder := class.ChainOrder{UserAddress: bob, OrderType: class.ChainMarket, OrderID: 3, Price: ether("1"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh}
+	if err := options.Apply([]class.ChainOrder{marketOrder}, class.NewTriggerEngine(), ts, class.NewOCOGroups()); err == nil {
+		t.Errorf("Expected a market order that cannot trail to be reported")
+	}
+}
+
+func TestOrderOptionsOCO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "order_options.json")
+	if err := os.WriteFile(path, []byte(`{"oco": [[1, 2], [3, 4]]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	options, err := class.LoadOrderOptions(path)
+	if err != nil || len(options.OCO) != 2 {
+		t.Fatalf("Expected two OCO groups, got %+v %v", options, err)
+	}
+
+	orders := []class.ChainOrder{
+		{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 1, Price: ether("2"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		{UserAddress: alice, OrderType: class.ChainStop, OrderID: 2, Price: ether("0.5"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		{UserAddress: bob, OrderType: class.ChainLimit, OrderID: 3, Price: ether("2"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+	}
+
+	// order 4 is not open yet, its group waits for it
+	groups := class.NewOCOGroups()
+	apply := func() error {
+		return options.Apply(orders, class.NewTriggerEngine(), trailingStops(t), groups)
+	}
+	if err := apply(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if siblings := groups.GetSiblings(1); len(siblings) != 1 || siblings[0] != 2 {
+		t.Errorf("Expected orders 1 and 2 to be linked, got %v", siblings)
+	}
+	if siblings := groups.GetSiblings(3); len(siblings) != 0 {
+		t.Errorf("Expected order 3 to wait for order 4, got %v", siblings)
+	}
+
+	// applying again leaves the group alone, and a group that fired is not linked again
+	if err := apply(); err != nil {
+		t.Errorf("Expected applying the options again to be a no-op, got %v", err)
+	}
+	groups.Filled(1)
+	if err := apply(); err != nil || !groups.IsCancelled(2) || len(groups.GetSiblings(1)) != 0 {
+		t.Errorf("Expected the fired group to stay dissolved, got %v", err)
+	}
+
+	orders = append(orders, class.ChainOrder{UserAddress: bob, OrderType: class.ChainStop, OrderID: 4, Price: ether("0.5"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh})
+	if err := apply(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if siblings := groups.GetSiblings(3); len(siblings) != 1 || siblings[0] != 4 {
+		t.Errorf("Expected orders 3 and 4 to be linked once both are open, got %v", siblings)
+	}
+}
@@ -1,6 +1,10 @@
 package tests
 
 import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
 	"testing"
 
 	"orderbook.com/m/c"
@@ -52,4 +56,598 @@ func TestOrderBook(t *testing.T) {
 
 }
 
-//TODO: write more test
+func TestOrderBookPartialFill(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	sell := class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(50), c.Quantity(10))
+	buy := class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.BUY, c.Price(60), c.Quantity(4))
+
+	ob.AddOrder(sell)
+	trades, err := ob.AddOrder(buy)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(trades) != 1 || trades[0].GetBidTrade().Quantity != 4 {
+		t.Fatalf("Expected one trade of quantity 4, got %v", trades)
+	}
+	if sell.GetRemainingQuantity() != 6 {
+		t.Errorf("Expected sell to have 6 remaining, got %v", sell.GetRemainingQuantity())
+	}
+	if ob.Size() != 1 {
+		t.Errorf("Expected only the partially filled sell to rest, got %v orders", ob.Size())
+	}
+}
+
+func TestOrderBookPriceTimePriority(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(55), c.Quantity(5)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(50), c.Quantity(5)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.SELL, c.Price(50), c.Quantity(5)))
+
+	trades, _ := ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(4), c.BUY, c.Price(60), c.Quantity(12)))
+	expected := []c.OrderID{2, 3, 1}
+	if len(trades) != len(expected) {
+		t.Fatalf("Expected %v trades, got %v", len(expected), trades)
+	}
+	for i, id := range expected {
+		if trades[i].GetAskTrade().OrderId != id {
+			t.Errorf("Expected trade %v to hit ask %v, got %v", i, id, trades[i].GetAskTrade().OrderId)
+		}
+	}
+	if trades[2].GetAskTrade().Quantity != 2 {
+		t.Errorf("Expected last trade quantity 2, got %v", trades[2].GetAskTrade().Quantity)
+	}
+}
+
+func TestOrderBookDuplicateOrder(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.BUY, c.Price(50), c.Quantity(5)))
+	_, err := ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.BUY, c.Price(50), c.Quantity(5)))
+	if err == nil {
+		t.Error("Expected error for duplicate order ID, got none")
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.BUY, c.Price(50), c.Quantity(5)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.BUY, c.Price(50), c.Quantity(5)))
+
+	if err := ob.CancelOrder(c.OrderID(1)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	orders, _ := ob.GetBids().At(c.Price(50))
+	if len(orders) != 1 || orders[0].GetOrderID() != 2 {
+		t.Errorf("Expected only order 2 to remain at 50, got %v", orders)
+	}
+
+	ob.CancelOrder(c.OrderID(2))
+	if !ob.GetBids().Empty() {
+		t.Errorf("Expected empty price level to be dropped, got %v", ob.GetBids().GetData())
+	}
+
+	if err := ob.CancelOrder(c.OrderID(2)); err == nil {
+		t.Error("Expected error for cancelling an unknown order, got none")
+	}
+}
+
+func TestModifyOrderPriority(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(50), c.Quantity(10)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(50), c.Quantity(10)))
+
+	// size decrease keeps time priority
+	ob.ModifyOrder(c.OrderID(1), c.SELL, c.Price(50), c.Quantity(4))
+	orders, _ := ob.GetAsks().At(c.Price(50))
+	if orders[0].GetOrderID() != 1 || orders[0].GetRemainingQuantity() != 4 {
+		t.Errorf("Expected order 1 to stay in front with 4 remaining, got %v", orders[0])
+	}
+
+	// size increase loses time priority
+	ob.ModifyOrder(c.OrderID(1), c.SELL, c.Price(50), c.Quantity(8))
+	orders, _ = ob.GetAsks().At(c.Price(50))
+	if orders[0].GetOrderID() != 2 || orders[1].GetOrderID() != 1 {
+		t.Errorf("Expected order 1 to move behind order 2, got %v", orders)
+	}
+
+	// price change moves the order and can cross the book
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.BUY, c.Price(40), c.Quantity(8)))
+	trades, err := ob.ModifyOrder(c.OrderID(3), c.BUY, c.Price(50), c.Quantity(8))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(trades) != 1 || trades[0].GetAskTrade().OrderId != 2 {
+		t.Errorf("Expected modified bid to trade with order 2, got %v", trades)
+	}
+}
+
+func TestModifyOrderRejected(t *testing.T) {
+	ob := class.NewOrderbook()
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(100), c.Quantity(5)))
+
+	for _, orderID := range []c.OrderID{2, 3, 4} {
+		order := class.NewOrder(c.GoodTillCancel, orderID, c.BUY, c.Price(99), c.Quantity(5))
+		order.SetPostOnly(c.PostOnlyReject)
+		ob.AddOrder(order)
+	}
+
+	// a post-only order moved across the spread keeps its original price and queue position
+	if _, err := ob.ModifyOrder(c.OrderID(3), c.BUY, c.Price(101), c.Quantity(5)); !errors.Is(err, class.ErrPostOnlyWouldCross) {
+		t.Fatalf("Expected the modify to be rejected, got %v", err)
+	}
+	order, ok := ob.GetOrder(c.OrderID(3))
+	if !ok || order.GetPrice() != 99 || order.GetRemainingQuantity() != 5 {
+		t.Fatalf("Expected order 3 to stay at 99 for 5, got %v", order)
+	}
+	orders, _ := ob.GetBids().At(c.Price(99))
+	if len(orders) != 3 || orders[0].GetOrderID() != 2 || orders[1].GetOrderID() != 3 || orders[2].GetOrderID() != 4 {
+		t.Errorf("Expected order 3 to stay between 2 and 4, got %v", orders)
+	}
+	if ob.Size() != 4 {
+		t.Errorf("Expected 4 resting orders, got %v", ob.Size())
+	}
+
+	// the original still trades once the modify failed
+	trades, _ := ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(5), c.SELL, c.Price(99), c.Quantity(10)))
+	if len(trades) != 2 || trades[1].GetBidTrade().OrderId != 3 {
+		t.Errorf("Expected the sell to trade with 2 then 3, got %v", trades)
+	}
+}
+
+func TestFillAndKill(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	_, err := ob.AddOrder(class.NewOrder(c.FillAndKill, c.OrderID(1), c.BUY, c.Price(50), c.Quantity(5)))
+	if err == nil {
+		t.Error("Expected FillAndKill against an empty book to be rejected, got none")
+	}
+
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(50), c.Quantity(3)))
+	trades, err := ob.AddOrder(class.NewOrder(c.FillAndKill, c.OrderID(3), c.BUY, c.Price(50), c.Quantity(5)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(trades) != 1 || trades[0].GetBidTrade().Quantity != 3 {
+		t.Errorf("Expected one trade of quantity 3, got %v", trades)
+	}
+	if ob.Size() != 0 || !ob.GetBids().Empty() {
+		t.Errorf("Expected FillAndKill remainder to be cancelled, got %v resting orders", ob.Size())
+	}
+}
+
+func TestFillOrKill(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(50), c.Quantity(3)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(55), c.Quantity(3)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.SELL, c.Price(60), c.Quantity(3)))
+
+	_, err := ob.AddOrder(class.NewOrder(c.FillOrKill, c.OrderID(4), c.BUY, c.Price(55), c.Quantity(7)))
+	if err == nil {
+		t.Error("Expected FillOrKill without enough depth to be rejected, got none")
+	}
+	if ob.Size() != 3 {
+		t.Errorf("Expected rejected FillOrKill to leave the book untouched, got %v orders", ob.Size())
+	}
+
+	trades, err := ob.AddOrder(class.NewOrder(c.FillOrKill, c.OrderID(5), c.BUY, c.Price(55), c.Quantity(6)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(trades) != 2 || ob.Size() != 1 {
+		t.Errorf("Expected FillOrKill to sweep two levels, got %v trades and %v resting orders", len(trades), ob.Size())
+	}
+}
+
+func TestMarketOrder(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	_, err := ob.AddOrder(class.NewMarketOrder(c.OrderID(1), c.BUY, c.Quantity(5)))
+	if err == nil {
+		t.Error("Expected market order against an empty book to be rejected, got none")
+	}
+
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(50), c.Quantity(3)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.SELL, c.Price(70), c.Quantity(3)))
+
+	order := class.NewMarketOrder(c.OrderID(4), c.BUY, c.Quantity(5))
+	trades, err := ob.AddOrder(order)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(trades) != 2 {
+		t.Fatalf("Expected market order to sweep two levels, got %v", trades)
+	}
+	if order.GetOrderType() != c.GoodTillCancel || order.GetPrice() != c.Price(70) {
+		t.Errorf("Expected market order to become GoodTillCancel at 70, got %v at %v", order.GetOrderType(), order.GetPrice())
+	}
+	if trades[1].GetAskTrade().Price != c.Price(70) || trades[1].GetAskTrade().Quantity != 2 {
+		t.Errorf("Expected second trade of 2 at 70, got %v", trades[1].GetAskTrade())
+	}
+}
+
+func TestCancelDeepQueue(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	for i := 1; i <= 1000; i++ {
+		ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(i), c.SELL, c.Price(50), c.Quantity(1)))
+	}
+
+	// cancel every even order, the odd ones must still fill oldest first
+	for i := 2; i <= 1000; i += 2 {
+		if err := ob.CancelOrder(c.OrderID(i)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	trades, _ := ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1001), c.BUY, c.Price(50), c.Quantity(500)))
+	if len(trades) != 500 || ob.Size() != 0 {
+		t.Fatalf("Expected 500 trades and an empty book, got %v trades and %v orders", len(trades), ob.Size())
+	}
+	for i, trade := range trades {
+		if trade.GetAskTrade().OrderId != c.OrderID(2*i+1) {
+			t.Fatalf("Expected trade %v to hit ask %v, got %v", i, 2*i+1, trade.GetAskTrade().OrderId)
+		}
+	}
+}
+
+const benchmarkRestingOrders = 100000
+
+// newDeepBook rests every order on the same price level so the queue is as deep as possible
+func newDeepBook(quantity c.Quantity) *class.Orderbook {
+	ob := class.NewOrderbook()
+	for i := 0; i < benchmarkRestingOrders; i++ {
+		ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(i), c.SELL, c.Price(50), quantity))
+	}
+	return ob
+}
+
+func BenchmarkCancelDeepQueue(b *testing.B) {
+	ob := newDeepBook(c.Quantity(10))
+	ids := rand.New(rand.NewSource(1)).Perm(benchmarkRestingOrders)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := c.OrderID(ids[i%benchmarkRestingOrders])
+		ob.CancelOrder(id)
+		ob.AddOrder(class.NewOrder(c.GoodTillCancel, id, c.SELL, c.Price(50), c.Quantity(10)))
+	}
+}
+
+func BenchmarkModifyDeepQueue(b *testing.B) {
+	ob := newDeepBook(c.Quantity(10))
+	ids := rand.New(rand.NewSource(1)).Perm(benchmarkRestingOrders)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := c.OrderID(ids[i%benchmarkRestingOrders])
+		// alternate between losing and keeping time priority
+		ob.ModifyOrder(id, c.SELL, c.Price(50), c.Quantity(10+i%2))
+	}
+}
+
+func BenchmarkFillDeepQueue(b *testing.B) {
+	ob := newDeepBook(c.Quantity(1))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := c.OrderID(benchmarkRestingOrders + 2*i)
+		ob.AddOrder(class.NewOrder(c.GoodTillCancel, id, c.BUY, c.Price(50), c.Quantity(1)))
+		ob.AddOrder(class.NewOrder(c.GoodTillCancel, id+1, c.SELL, c.Price(50), c.Quantity(1)))
+	}
+}
+
+func TestGetLevelInfos(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.BUY, c.Price(48), c.Quantity(5)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.BUY, c.Price(48), c.Quantity(3)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.BUY, c.Price(46), c.Quantity(4)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(4), c.BUY, c.Price(41), c.Quantity(1)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(5), c.SELL, c.Price(51), c.Quantity(6)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(6), c.SELL, c.Price(53), c.Quantity(2)))
+
+	// a partial fill and a size decrease must both show up in the totals
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(7), c.BUY, c.Price(51), c.Quantity(2)))
+	ob.ModifyOrder(c.OrderID(2), c.BUY, c.Price(48), c.Quantity(1))
+
+	infos := ob.GetLevelInfos(0, 0)
+	expectedBids := class.LevelInfos{{Price: 48, Quantity: 6, Count: 2}, {Price: 46, Quantity: 4, Count: 1}, {Price: 41, Quantity: 1, Count: 1}}
+	expectedAsks := class.LevelInfos{{Price: 51, Quantity: 4, Count: 1}, {Price: 53, Quantity: 2, Count: 1}}
+	if fmt.Sprint(infos.GetBids()) != fmt.Sprint(expectedBids) {
+		t.Errorf("Expected bids %v, got %v", expectedBids, infos.GetBids())
+	}
+	if fmt.Sprint(infos.GetAsks()) != fmt.Sprint(expectedAsks) {
+		t.Errorf("Expected asks %v, got %v", expectedAsks, infos.GetAsks())
+	}
+
+	// depth limit
+	infos = ob.GetLevelInfos(1, 0)
+	if len(infos.GetBids()) != 1 || len(infos.GetAsks()) != 1 {
+		t.Errorf("Expected one level per side, got %v and %v", infos.GetBids(), infos.GetAsks())
+	}
+
+	// bids round down and asks round up into buckets of 5
+	infos = ob.GetLevelInfos(0, 5)
+	expectedBids = class.LevelInfos{{Price: 45, Quantity: 10, Count: 3}, {Price: 40, Quantity: 1, Count: 1}}
+	expectedAsks = class.LevelInfos{{Price: 55, Quantity: 6, Count: 2}}
+	if fmt.Sprint(infos.GetBids()) != fmt.Sprint(expectedBids) {
+		t.Errorf("Expected bucketed bids %v, got %v", expectedBids, infos.GetBids())
+	}
+	if fmt.Sprint(infos.GetAsks()) != fmt.Sprint(expectedAsks) {
+		t.Errorf("Expected bucketed asks %v, got %v", expectedAsks, infos.GetAsks())
+	}
+
+	// cancelling the last order of a level removes it from the snapshot
+	ob.CancelOrder(c.OrderID(4))
+	if bids := ob.GetLevelInfos(0, 0).GetBids(); len(bids) != 2 {
+		t.Errorf("Expected two bid levels after cancel, got %v", bids)
+	}
+
+	// prices on a decimal tick stay in their own bucket, 0.3/0.1 is just below 3 in floats
+	decimal := class.NewOrderbook()
+	decimal.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.BUY, c.Price(0.3), c.Quantity(5)))
+	decimal.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.BUY, c.Price(0.25), c.Quantity(1)))
+	decimal.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.SELL, c.Price(0.7), c.Quantity(2)))
+	decimal.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(4), c.SELL, c.Price(0.61), c.Quantity(3)))
+
+	infos = decimal.GetLevelInfos(0, 0.1)
+	expectedBids = class.LevelInfos{{Price: 0.3, Quantity: 5, Count: 1}, {Price: 0.2, Quantity: 1, Count: 1}}
+	expectedAsks = class.LevelInfos{{Price: 0.7, Quantity: 5, Count: 2}}
+	if fmt.Sprint(infos.GetBids()) != fmt.Sprint(expectedBids) {
+		t.Errorf("Expected decimal bids %v, got %v", expectedBids, infos.GetBids())
+	}
+	if fmt.Sprint(infos.GetAsks()) != fmt.Sprint(expectedAsks) {
+		t.Errorf("Expected decimal asks %v, got %v", expectedAsks, infos.GetAsks())
+	}
+}
+
+func TestSelfTradePrevention(t *testing.T) {
+	tests := []struct {
+		mode            c.SelfTradePrevention
+		tradeQuantities []c.Quantity
+		resting         []c.OrderID
+	}{
+		{c.CancelNewest, []c.Quantity{}, []c.OrderID{1, 2}},
+		{c.CancelOldest, []c.Quantity{5}, []c.OrderID{3}},
+		{c.CancelBoth, []c.Quantity{}, []c.OrderID{2}},
+		{c.DecrementAndCancel, []c.Quantity{3}, []c.OrderID{2}},
+		{c.AllowSelfTrade, []c.Quantity{5, 3}, []c.OrderID{2}},
+	}
+
+	for _, tt := range tests {
+		ob := class.NewOrderbook()
+		ob.SetSelfTradePrevention(tt.mode)
+
+		own := class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(50), c.Quantity(5))
+		own.SetOwner("0xA")
+		other := class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(51), c.Quantity(5))
+		other.SetOwner("0xB")
+		taker := class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.BUY, c.Price(55), c.Quantity(8))
+		taker.SetOwner("0xA")
+
+		ob.AddOrder(own)
+		ob.AddOrder(other)
+		trades, err := ob.AddOrder(taker)
+		if err != nil {
+			t.Fatalf("%v: expected no error, got %v", tt.mode, err)
+		}
+
+		quantities := []c.Quantity{}
+		for _, trade := range trades {
+			if trade.GetAskTrade().OrderId == 1 && tt.mode != c.AllowSelfTrade {
+				t.Errorf("%v: expected no trade between orders of the same owner", tt.mode)
+			}
+			quantities = append(quantities, trade.GetQuantity())
+		}
+		if fmt.Sprint(quantities) != fmt.Sprint(tt.tradeQuantities) {
+			t.Errorf("%v: expected trade quantities %v, got %v", tt.mode, tt.tradeQuantities, quantities)
+		}
+
+		if ob.Size() != len(tt.resting) {
+			t.Errorf("%v: expected resting orders %v, got %v orders", tt.mode, tt.resting, ob.Size())
+		}
+		for _, id := range tt.resting {
+			if err := ob.CancelOrder(id); err != nil {
+				t.Errorf("%v: expected order %v to rest, got %v", tt.mode, id, err)
+			}
+		}
+	}
+}
+
+func TestSelfTradePreventionFillOrKill(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	own := class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(50), c.Quantity(5))
+	own.SetOwner("0xA")
+	other := class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(51), c.Quantity(5))
+	other.SetOwner("0xB")
+	ob.AddOrder(own)
+	ob.AddOrder(other)
+
+	// with CancelNewest the own order would cancel the FillOrKill half way, so it is rejected up front
+	fok := class.NewOrder(c.FillOrKill, c.OrderID(3), c.BUY, c.Price(55), c.Quantity(5))
+	fok.SetOwner("0xA")
+	if _, err := ob.AddOrder(fok); err == nil {
+		t.Error("Expected FillOrKill blocked by its own order to be rejected, got none")
+	}
+
+	// with CancelOldest the own order is skipped and only the other owner counts as liquidity
+	ob.SetSelfTradePrevention(c.CancelOldest)
+	fok = class.NewOrder(c.FillOrKill, c.OrderID(4), c.BUY, c.Price(55), c.Quantity(5))
+	fok.SetOwner("0xA")
+	trades, err := ob.AddOrder(fok)
+	if err != nil || len(trades) != 1 || trades[0].GetAskTrade().OrderId != 2 {
+		t.Errorf("Expected FillOrKill to fill against order 2, got %v, %v", trades, err)
+	}
+}
+
+func TestIcebergOrder(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	ob.AddOrder(class.NewIcebergOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(100), c.Quantity(25), c.Quantity(10)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(100), c.Quantity(5)))
+
+	// only the visible slice shows in the depth
+	asks := ob.GetLevelInfos(0, 0).GetAsks()
+	if len(asks) != 1 || asks[0].Quantity != 15 || asks[0].Count != 2 {
+		t.Fatalf("Expected 15 visible in 2 orders, got %v", asks)
+	}
+
+	// the first slice fills, the next one goes behind order 2
+	trades, _ := ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.BUY, c.Price(100), c.Quantity(12)))
+	if len(trades) != 2 || trades[0].GetMakerOrderID() != 1 || trades[0].GetQuantity() != 10 || trades[1].GetMakerOrderID() != 2 || trades[1].GetQuantity() != 2 {
+		t.Fatalf("Expected 10 from the iceberg then 2 from order 2, got %v", trades)
+	}
+
+	iceberg, _ := ob.GetOrder(c.OrderID(1))
+	if iceberg.GetRemainingQuantity() != 15 || iceberg.GetVisibleQuantity() != 10 || iceberg.GetFilledQuantity() != 10 {
+		t.Errorf("Expected 15 left with 10 visible, got %v and %v", iceberg.GetRemainingQuantity(), iceberg.GetVisibleQuantity())
+	}
+	if front := ob.GetAsks().Front(); front.GetOrderID() != 2 {
+		t.Errorf("Expected the refreshed iceberg to lose priority to order 2, got %v", front.GetOrderID())
+	}
+	asks = ob.GetLevelInfos(0, 0).GetAsks()
+	if asks[0].Quantity != 13 {
+		t.Errorf("Expected 3 from order 2 and a fresh slice of 10 visible, got %v", asks[0].Quantity)
+	}
+
+	// hidden quantity is still liquidity for FillOrKill and the last slice is smaller than the display
+	trades, err := ob.AddOrder(class.NewOrder(c.FillOrKill, c.OrderID(4), c.BUY, c.Price(100), c.Quantity(18)))
+	if err != nil {
+		t.Fatalf("Expected the hidden quantity to fill the order, got %v", err)
+	}
+	if len(trades) != 3 || trades[2].GetQuantity() != 5 {
+		t.Errorf("Expected 3 from order 2, then slices of 10 and 5, got %v", trades)
+	}
+	if ob.Size() != 0 {
+		t.Errorf("Expected an empty book, got %v orders", ob.Size())
+	}
+}
+
+func TestIcebergModifyAndTake(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	ob.AddOrder(class.NewIcebergOrder(c.GoodTillCancel, c.OrderID(1), c.BUY, c.Price(100), c.Quantity(30), c.Quantity(10)))
+
+	// shrinking below the visible slice shrinks the slice too
+	ob.ModifyOrder(c.OrderID(1), c.BUY, c.Price(100), c.Quantity(4))
+	if bids := ob.GetLevelInfos(0, 0).GetBids(); bids[0].Quantity != 4 {
+		t.Errorf("Expected 4 visible, got %v", bids)
+	}
+
+	// a replacement stays an iceberg
+	ob.ModifyOrder(c.OrderID(1), c.BUY, c.Price(101), c.Quantity(30))
+	if bids := ob.GetLevelInfos(0, 0).GetBids(); bids[0].Price != 101 || bids[0].Quantity != 10 {
+		t.Errorf("Expected 10 visible at 101, got %v", bids)
+	}
+
+	// an incoming iceberg keeps taking slice after slice until it is filled or the book runs out
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(102), c.Quantity(25)))
+	trades, _ := ob.AddOrder(class.NewIcebergOrder(c.GoodTillCancel, c.OrderID(3), c.BUY, c.Price(102), c.Quantity(40), c.Quantity(10)))
+
+	var filled c.Quantity
+	for _, trade := range trades {
+		filled += trade.GetQuantity()
+	}
+	if filled != 25 {
+		t.Errorf("Expected the incoming iceberg to take all 25, got %v", filled)
+	}
+	if bids := ob.GetLevelInfos(0, 0).GetBids(); bids[0].Price != 102 || bids[0].Quantity != 5 {
+		t.Errorf("Expected what is left of the current slice to rest at 102, got %v", bids)
+	}
+	if err := class.NewIcebergOrder(c.GoodTillCancel, c.OrderID(4), c.BUY, c.Price(1), c.Quantity(20), c.Quantity(5)).Fill(6); err == nil {
+		t.Errorf("Expected filling past the visible slice to fail")
+	}
+}
+
+func TestPostOnlyReject(t *testing.T) {
+	ob := class.NewOrderbook()
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(100), c.Quantity(5)))
+
+	crossing := class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.BUY, c.Price(100), c.Quantity(5))
+	crossing.SetPostOnly(c.PostOnlyReject)
+	trades, err := ob.AddOrder(crossing)
+	if !errors.Is(err, class.ErrPostOnlyWouldCross) || len(trades) != 0 {
+		t.Fatalf("Expected the crossing post-only order to be rejected, got %v %v", trades, err)
+	}
+	if !strings.Contains(err.Error(), "best ask at 100") {
+		t.Errorf("Expected the reason to name the best ask, got %v", err)
+	}
+	if ob.Size() != 1 {
+		t.Errorf("Expected the book to be untouched, got %v orders", ob.Size())
+	}
+
+	resting := class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.BUY, c.Price(99), c.Quantity(5))
+	resting.SetPostOnly(c.PostOnlyReject)
+	if _, err := ob.AddOrder(resting); err != nil {
+		t.Errorf("Expected a non crossing post-only order to rest, got %v", err)
+	}
+
+	// moving a post-only order across the spread is rejected too
+	if _, err := ob.ModifyOrder(c.OrderID(3), c.BUY, c.Price(101), c.Quantity(5)); !errors.Is(err, class.ErrPostOnlyWouldCross) {
+		t.Errorf("Expected the modify to be rejected, got %v", err)
+	}
+
+	for _, orderType := range []c.OrderType{c.FillAndKill, c.FillOrKill, c.Market} {
+		order := class.NewOrder(orderType, c.OrderID(4), c.BUY, c.Price(100), c.Quantity(1))
+		order.SetPostOnly(c.PostOnlyReject)
+		if _, err := ob.AddOrder(order); !errors.Is(err, class.ErrPostOnlyWouldCross) {
+			t.Errorf("Expected %v to be rejected as post-only, got %v", orderType, err)
+		}
+	}
+}
+
+func TestPostOnlySlide(t *testing.T) {
+	ob := class.NewOrderbook()
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(100), c.Quantity(5)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.BUY, c.Price(97), c.Quantity(5)))
+
+	buy := class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.BUY, c.Price(102), c.Quantity(5))
+	buy.SetPostOnly(c.PostOnlySlide)
+	if _, err := ob.AddOrder(buy); !errors.Is(err, class.ErrPostOnlyWouldCross) {
+		t.Errorf("Expected sliding without a tick size to be rejected, got %v", err)
+	}
+
+	if err := ob.SetTickSize(0); err == nil {
+		t.Errorf("Expected a zero tick size to be rejected")
+	}
+	ob.SetTickSize(0.5)
+
+	trades, err := ob.AddOrder(buy)
+	if err != nil || len(trades) != 0 || buy.GetPrice() != 99.5 {
+		t.Fatalf("Expected the buy to slide to 99.5 without trading, got %v %v at %v", trades, err, buy.GetPrice())
+	}
+
+	sell := class.NewOrder(c.GoodTillCancel, c.OrderID(4), c.SELL, c.Price(90), c.Quantity(5))
+	sell.SetPostOnly(c.PostOnlySlide)
+	if _, err := ob.AddOrder(sell); err != nil || sell.GetPrice() != 100 {
+		t.Errorf("Expected the sell to slide to 100, got %v at %v", err, sell.GetPrice())
+	}
+
+	infos := ob.GetLevelInfos(1, 0)
+	if infos.GetBids()[0].Price != 99.5 || infos.GetAsks()[0].Price != 100 {
+		t.Errorf("Expected a 99.5 / 100 spread, got %v and %v", infos.GetBids(), infos.GetAsks())
+	}
+}
+
+func TestGetSidesAreCopies(t *testing.T) {
+	ob := class.NewOrderbook()
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.BUY, c.Price(50), c.Quantity(5)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(51), c.Quantity(5)))
+
+	bids, asks := ob.GetBids(), ob.GetAsks()
+	bids.Erase(c.Price(50))
+	asks.PopFront(c.Price(51))
+
+	if ob.Size() != 2 || ob.GetBids().Empty() || ob.GetAsks().Empty() {
+		t.Errorf("Expected the book to be left alone, got %v bids and %v asks", ob.GetBids().GetData(), ob.GetAsks().GetData())
+	}
+	if trades, _ := ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.SELL, c.Price(50), c.Quantity(5))); len(trades) != 1 {
+		t.Errorf("Expected order 3 to still match order 1, got %v", trades)
+	}
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"orderbook.com/m/c"
+	"orderbook.com/m/class"
+	"orderbook.com/m/fixed"
+)
+
+var (
+	tokenLow  = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	tokenHigh = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	tokenMid  = common.HexToAddress("0x1500000000000000000000000000000000000003")
+	alice     = common.HexToAddress("0xa11ce00000000000000000000000000000000001")
+	bob       = common.HexToAddress("0xb0b0000000000000000000000000000000000002")
+)
+
+// ether scales a decimal amount to 18 decimals
+func ether(amount string) *big.Int {
+	value, _ := fixed.Parse(amount)
+	return value.Raw()
+}
+
+func TestNewTokenPair(t *testing.T) {
+	pair := class.NewTokenPair(tokenHigh, tokenLow)
+	if pair.Base != tokenLow || pair.Quote != tokenHigh {
+		t.Errorf("Expected base %v and quote %v, got %v", tokenLow.Hex(), tokenHigh.Hex(), pair)
+	}
+	if pair != class.NewTokenPair(tokenLow, tokenHigh) {
+		t.Error("Expected the pair to be the same whichever way the tokens are given")
+	}
+}
+
+func TestToEngineOrder(t *testing.T) {
+	registry := class.NewOrderbookRegistry()
+
+	// selling 2 of the base for 3 quote each
+	sell := class.ChainOrder{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 1, Price: ether("3"), Quantity: ether("2"), TokenPair0: tokenLow, TokenPair1: tokenHigh}
+	order, pair, err := registry.ToEngineOrder(sell)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if pair.Base != tokenLow || order.GetSide() != c.SELL || order.GetPrice() != 3 || order.GetRemainingQuantity() != 2e9 {
+		t.Errorf("Expected SELL 2e9 at 3, got %v %v at %v", order.GetSide(), order.GetRemainingQuantity(), order.GetPrice())
+	}
+	if order.GetOwner() != alice.Hex() || order.GetOrderType() != c.GoodTillCancel {
+		t.Errorf("Expected a GoodTillCancel order owned by alice, got %v owned by %v", order.GetOrderType(), order.GetOwner())
+	}
+
+	// selling 6 of the quote at 0.25 base each buys 1.5 base at 4
+	buy := class.ChainOrder{UserAddress: bob, OrderType: class.ChainLimit, OrderID: 2, Price: ether("0.25"), Quantity: ether("6"), TokenPair0: tokenHigh, TokenPair1: tokenLow}
+	order, _, err = registry.ToEngineOrder(buy)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if order.GetSide() != c.BUY || order.GetPrice() != 4 || order.GetRemainingQuantity() != 15e8 {
+		t.Errorf("Expected BUY 15e8 at 4, got %v %v at %v", order.GetSide(), order.GetRemainingQuantity(), order.GetPrice())
+	}
+
+	stop := sell
+	stop.OrderType = class.ChainStop
+	if _, _, err := registry.ToEngineOrder(stop); err == nil {
+		t.Error("Expected a stop order to be rejected, got none")
+	}
+
+	dust := sell
+	dust.Quantity = big.NewInt(10)
+	if _, _, err := registry.ToEngineOrder(dust); err == nil {
+		t.Error("Expected a quantity below the book scale to be rejected, got none")
+	}
+}
+
+func TestRegistryRouting(t *testing.T) {
+	registry := class.NewOrderbookRegistry()
+
+	registry.AddChainOrder(class.ChainOrder{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 1, Price: ether("3"), Quantity: ether("2"), TokenPair0: tokenLow, TokenPair1: tokenHigh})
+	registry.AddChainOrder(class.ChainOrder{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 2, Price: ether("1"), Quantity: ether("1"), TokenPair0: tokenMid, TokenPair1: tokenHigh})
+
+	pairs := registry.GetPairs()
+	if len(pairs) != 2 || pairs[0].Quote != tokenHigh || pairs[1].Base != tokenMid {
+		t.Fatalf("Expected books for low/high and mid/high, got %v", pairs)
+	}
+
+	// bob sells quote for base at 0.25, a bid at 4 that crosses alice's ask at 3
+	trades, err := registry.AddChainOrder(class.ChainOrder{UserAddress: bob, OrderType: class.ChainLimit, OrderID: 3, Price: ether("0.25"), Quantity: ether("4"), TokenPair0: tokenHigh, TokenPair1: tokenLow})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(trades) != 1 || trades[0].GetMakerOrderID() != 1 || trades[0].GetQuantity() != 1e9 {
+		t.Errorf("Expected bob to take 1e9 from order 1, got %v", trades)
+	}
+
+	if err := registry.CancelOrder(3); err == nil {
+		t.Error("Expected the filled order 3 to be gone, got none")
+	}
+	if err := registry.CancelOrder(2); err != nil {
+		t.Errorf("Expected order 2 to be cancelled from the mid/high book, got %v", err)
+	}
+	if registry.GetOrderbook(tokenHigh, tokenMid).Size() != 0 {
+		t.Error("Expected the mid/high book to be empty")
+	}
+}
+
+func TestRegistrySync(t *testing.T) {
+	registry := class.NewOrderbookRegistry()
+
+	orders := []class.ChainOrder{
+		{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 1, Price: ether("3"), Quantity: ether("2"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 2, Price: ether("3.5"), Quantity: ether("2"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		{UserAddress: bob, OrderType: class.ChainStop, OrderID: 3, Price: ether("2"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+	}
+	if _, err := registry.Sync(orders); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	book := registry.GetOrderbook(tokenLow, tokenHigh)
+	if book.Size() != 2 {
+		t.Fatalf("Expected the two limit orders to rest, got %v", book.Size())
+	}
+
+	// order 1 was partly executed on chain and order 2 was cancelled
+	orders = []class.ChainOrder{orders[0]}
+	orders[0].Quantity = ether("0.5")
+	if _, err := registry.Sync(orders); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if book.Size() != 1 {
+		t.Fatalf("Expected order 2 to be cancelled, got %v orders", book.Size())
+	}
+	order, ok := book.GetOrder(c.OrderID(1))
+	if !ok || order.GetRemainingQuantity() != 5e8 {
+		t.Errorf("Expected order 1 to shrink to 5e8, got %v", order)
+	}
+
+	bad := []class.ChainOrder{orders[0], {UserAddress: bob, OrderType: class.ChainLimit, OrderID: 4, Price: big.NewInt(0), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh}}
+	if _, err := registry.Sync(bad); err == nil {
+		t.Error("Expected an order without price to be reported, got none")
+	}
+}
+
+func TestRegistrySyncSameSnapshot(t *testing.T) {
+	registry := class.NewOrderbookRegistry()
+
+	// 1 and 2 cross off-chain, the snapshot still holds both of them
+	orders := []class.ChainOrder{
+		{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 1, Price: ether("2"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		{UserAddress: bob, OrderType: class.ChainLimit, OrderID: 2, Price: ether("0.5"), Quantity: ether("2"), TokenPair0: tokenHigh, TokenPair1: tokenLow},
+	}
+
+	trades, err := registry.Sync(orders)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if pairTrades := trades[class.NewTokenPair(tokenLow, tokenHigh)]; len(pairTrades) != 1 {
+		t.Fatalf("Expected one trade on the first sync, got %v", trades)
+	}
+
+	for i := 0; i < 2; i++ {
+		trades, err = registry.Sync(orders)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(trades) != 0 {
+			t.Fatalf("Expected the matched orders to be skipped, got %v", trades)
+		}
+	}
+	if size := registry.GetOrderbook(tokenLow, tokenHigh).Size(); size != 0 {
+		t.Fatalf("Expected an empty book, got %v orders", size)
+	}
+
+	// both were partly executed on chain, they are matched again for what they have left
+	orders[0].Quantity = ether("0.5")
+	orders[1].Quantity = ether("1")
+	trades, err = registry.Sync(orders)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(trades) != 1 {
+		t.Errorf("Expected the changed order to be matched again, got %v", trades)
+	}
+}
@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"orderbook.com/m/class"
+	"orderbook.com/m/fixed"
+)
+
+var (
+	ringTokenA = common.HexToAddress("0x000000000000000000000000000000000000000a")
+	ringTokenB = common.HexToAddress("0x000000000000000000000000000000000000000b")
+)
+
+func ringOrder(orderID uint64, price, quantity string, from, to common.Address) class.ChainOrder {
+	return class.ChainOrder{
+		UserAddress: common.BigToAddress(big.NewInt(int64(orderID))),
+		OrderType:   class.ChainLimit,
+		OrderID:     orderID,
+		Price:       ether(price),
+		Quantity:    ether(quantity),
+		TokenPair0:  from,
+		TokenPair1:  to,
+	}
+}
+
+// checkRingFill replays the pricing check matchTrade runs on every pair of the list and makes
+// sure no order trades more than it holds
+func checkRingFill(t *testing.T, fill class.RingFill, legs [][]class.ChainOrder) {
+	t.Helper()
+
+	held := make(map[uint64]*big.Int)
+	for _, leg := range legs {
+		for _, order := range leg {
+			held[order.OrderID] = order.Quantity
+		}
+	}
+
+	traded := make(map[uint64]*big.Int)
+	for i, start := range fill.Orders {
+		end := fill.Orders[(i+1)%len(fill.Orders)]
+		if start.TokenPair1 != end.TokenPair0 {
+			t.Errorf("Order %v is followed by order %v which does not sell what it buys", start.OrderID, end.OrderID)
+		}
+
+		paid, _ := fixed.Mul(fill.Quantities[i], start.Price, fixed.Floor)
+		if fill.Quantities[(i+1)%len(fill.Orders)].Cmp(paid) < 0 {
+			t.Errorf("Order %v is paid %v but order %v only delivers %v", start.OrderID, paid, end.OrderID, fill.Quantities[(i+1)%len(fill.Orders)])
+		}
+
+		if traded[start.OrderID] == nil {
+			traded[start.OrderID] = new(big.Int)
+		}
+		traded[start.OrderID].Add(traded[start.OrderID], fill.Quantities[i])
+	}
+
+	for orderID, quantity := range traded {
+		if quantity.Cmp(held[orderID]) > 0 {
+			t.Errorf("Order %v trades %v but only holds %v", orderID, quantity, held[orderID])
+		}
+	}
+}
+
+func TestFillRingSingleLap(t *testing.T) {
+	legs := [][]class.ChainOrder{
+		{ringOrder(1, "2", "10", ringTokenA, ringTokenB)},
+		{ringOrder(2, "0.4", "30", ringTokenB, ringTokenA)},
+	}
+
+	fill, err := class.FillRing(legs)
+	if err != nil {
+		t.Fatalf("FillRing failed: %v", err)
+	}
+	if fill.Laps != 1 || !reflect.DeepEqual(fill.GetOrderIDs(), []uint64{1, 2}) {
+		t.Fatalf("Expected one lap of orders [1 2], got %d laps of %v", fill.Laps, fill.GetOrderIDs())
+	}
+	if fill.Quantities[0].Cmp(ether("10")) != 0 || fill.Quantities[1].Cmp(ether("20")) != 0 {
+		t.Errorf("Expected quantities [10 20] ether, got %v", fill.Quantities)
+	}
+	checkRingFill(t, fill, legs)
+}
+
+func TestFillRingPricePriority(t *testing.T) {
+	legs := [][]class.ChainOrder{
+		{
+			ringOrder(3, "2", "8", ringTokenA, ringTokenB),
+			ringOrder(4, "3", "50", ringTokenA, ringTokenB),
+			ringOrder(1, "2", "10", ringTokenA, ringTokenB),
+		},
+		{ringOrder(2, "0.4", "40", ringTokenB, ringTokenA)},
+	}
+
+	fill, err := class.FillRing(legs)
+	if err != nil {
+		t.Fatalf("FillRing failed: %v", err)
+	}
+
+	// orders 1 and 3 share the best price and 1 is older, order 4 at 3 would leave no surplus.
+	// The smaller lap of order 3 is listed first
+	if fill.Laps != 2 || !reflect.DeepEqual(fill.GetOrderIDs(), []uint64{3, 2, 1, 2}) {
+		t.Fatalf("Expected two laps of orders [3 2 1 2], got %d laps of %v", fill.Laps, fill.GetOrderIDs())
+	}
+	want := []*big.Int{ether("8"), ether("16"), ether("10"), ether("20")}
+	for i := range want {
+		if fill.Quantities[i].Cmp(want[i]) != 0 {
+			t.Fatalf("Expected quantities %v, got %v", want, fill.Quantities)
+		}
+	}
+	checkRingFill(t, fill, legs)
+}
+
+func TestFillRingDropsSmallLaps(t *testing.T) {
+	legs := [][]class.ChainOrder{
+		{
+			ringOrder(1, "2", "10", ringTokenA, ringTokenB),
+			ringOrder(3, "2.2", "10", ringTokenA, ringTokenB),
+		},
+		{ringOrder(2, "0.4", "30", ringTokenB, ringTokenA)},
+	}
+
+	fill, err := class.FillRing(legs)
+	if err != nil {
+		t.Fatalf("FillRing failed: %v", err)
+	}
+
+	// the second lap is too small to pay the 8 ether the first one closes with
+	if fill.Laps != 1 || !reflect.DeepEqual(fill.GetOrderIDs(), []uint64{1, 2}) {
+		t.Fatalf("Expected one lap of orders [1 2], got %d laps of %v", fill.Laps, fill.GetOrderIDs())
+	}
+	checkRingFill(t, fill, legs)
+}
+
+func TestFillRingThreeLegs(t *testing.T) {
+	tokenC := common.HexToAddress("0x000000000000000000000000000000000000000c")
+	legs := [][]class.ChainOrder{
+		{
+			ringOrder(1, "2", "5", ringTokenA, ringTokenB),
+			ringOrder(4, "2", "5", ringTokenA, ringTokenB),
+		},
+		{ringOrder(2, "3", "100", ringTokenB, tokenC)},
+		{
+			ringOrder(3, "0.15", "60", tokenC, ringTokenA),
+			ringOrder(5, "0.16", "40", tokenC, ringTokenA),
+		},
+	}
+
+	fill, err := class.FillRing(legs)
+	if err != nil {
+		t.Fatalf("FillRing failed: %v", err)
+	}
+	if fill.Laps != 2 || !reflect.DeepEqual(fill.GetOrderIDs(), []uint64{1, 2, 3, 4, 2, 3}) {
+		t.Fatalf("Expected two laps of orders [1 2 3 4 2 3], got %d laps of %v", fill.Laps, fill.GetOrderIDs())
+	}
+	checkRingFill(t, fill, legs)
+}
+
+func TestFillRingErrors(t *testing.T) {
+	if _, err := class.FillRing([][]class.ChainOrder{{ringOrder(1, "1", "1", ringTokenA, ringTokenB)}}); err == nil {
+		t.Errorf("Expected an error for a single leg")
+	}
+
+	broken := [][]class.ChainOrder{
+		{ringOrder(1, "1", "1", ringTokenA, ringTokenB)},
+		{ringOrder(2, "1", "1", ringTokenA, ringTokenB)},
+	}
+	if _, err := class.FillRing(broken); err == nil {
+		t.Errorf("Expected an error for legs that do not connect")
+	}
+
+	costly := [][]class.ChainOrder{
+		{ringOrder(1, "2", "10", ringTokenA, ringTokenB)},
+		{ringOrder(2, "0.6", "30", ringTokenB, ringTokenA)},
+	}
+	fill, err := class.FillRing(costly)
+	if err != nil {
+		t.Fatalf("FillRing failed: %v", err)
+	}
+	if fill.Laps != 0 || len(fill.Orders) != 0 {
+		t.Errorf("Expected no laps for a ring without surplus, got %v", fill.GetOrderIDs())
+	}
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"orderbook.com/m/c"
+	"orderbook.com/m/class"
+)
+
+var (
+	ringTokenC = common.HexToAddress("0x000000000000000000000000000000000000000c")
+	ringTokenD = common.HexToAddress("0x000000000000000000000000000000000000000d")
+	ringTokenE = common.HexToAddress("0x000000000000000000000000000000000000000e")
+	ringTokenF = common.HexToAddress("0x000000000000000000000000000000000000000f")
+)
+
+// backlogGraph holds three rings on separate pairs, every one is used up by its own batch
+func backlogGraph() *class.RingGraph {
+	graph := class.NewRingGraph()
+	for _, order := range []class.ChainOrder{
+		ringOrder(1, "2", "10", ringTokenA, ringTokenB),
+		ringOrder(2, "0.4", "20", ringTokenB, ringTokenA),
+		ringOrder(3, "3", "10", ringTokenC, ringTokenD),
+		ringOrder(4, "0.25", "30", ringTokenD, ringTokenC),
+		ringOrder(5, "1", "10", ringTokenE, ringTokenF),
+		ringOrder(6, "0.9", "10", ringTokenF, ringTokenE),
+	} {
+		graph.AddOrder(order)
+	}
+	return graph
+}
+
+func TestRingGraphClearBacklog(t *testing.T) {
+	graph := backlogGraph()
+
+	fills := graph.Clear(32)
+	if len(fills) != 3 {
+		t.Fatalf("Expected three batches, got %d", len(fills))
+	}
+
+	// the ring leaving the most surplus goes first
+	expected := [][]uint64{{3, 4}, {1, 2}, {5, 6}}
+	for i, fill := range fills {
+		if !reflect.DeepEqual(fill.GetOrderIDs(), expected[i]) {
+			t.Errorf("Expected batch %d to hold %v, got %v", i, expected[i], fill.GetOrderIDs())
+		}
+	}
+
+	for _, pair := range [][2]common.Address{{ringTokenA, ringTokenB}, {ringTokenB, ringTokenA}, {ringTokenC, ringTokenD}, {ringTokenD, ringTokenC}, {ringTokenE, ringTokenF}, {ringTokenF, ringTokenE}} {
+		if queue := graph.GetQueue(pair[0], pair[1]); len(queue) != 0 {
+			t.Errorf("Expected the %v -> %v queue to be cleared, got %v", pair[0].Hex(), pair[1].Hex(), queue)
+		}
+	}
+	if fills := graph.Clear(32); len(fills) != 0 {
+		t.Errorf("Expected nothing left to clear, got %v", fills)
+	}
+}
+
+func TestRingGraphClearMaxRounds(t *testing.T) {
+	graph := backlogGraph()
+
+	if fills := graph.Clear(2); len(fills) != 2 {
+		t.Fatalf("Expected the rounds to stop at two batches, got %d", len(fills))
+	}
+	if queue := graph.GetQueue(ringTokenE, ringTokenF); len(queue) != 1 || queue[0].OrderID != 5 {
+		t.Errorf("Expected the ring with the least surplus to stay queued, got %v", queue)
+	}
+
+	fills := graph.Clear(2)
+	if len(fills) != 1 || !reflect.DeepEqual(fills[0].GetOrderIDs(), []uint64{5, 6}) {
+		t.Errorf("Expected the next call to clear the third ring, got %v", fills)
+	}
+}
+
+func TestRingGraphPartialConsume(t *testing.T) {
+	snapshot := []class.ChainOrder{
+		ringOrder(1, "2", "10", ringTokenA, ringTokenB),
+		ringOrder(2, "0.4", "30", ringTokenB, ringTokenA),
+	}
+
+	graph := class.NewRingGraph()
+	for _, order := range snapshot {
+		graph.AddOrder(order)
+	}
+
+	fills := graph.Clear(32)
+	if len(fills) != 1 || fills[0].Quantities[1].Cmp(ether("20")) != 0 {
+		t.Fatalf("Expected one batch trading 20 of order 2, got %v", fills)
+	}
+
+	queue := graph.GetQueue(ringTokenB, ringTokenA)
+	if len(queue) != 1 || queue[0].OrderID != 2 || queue[0].Quantity.Cmp(ether("10")) != 0 {
+		t.Errorf("Expected order 2 to stay queued with 10 left, got %v", queue)
+	}
+	if queue := graph.GetQueue(ringTokenA, ringTokenB); len(queue) != 0 {
+		t.Errorf("Expected order 1 to be used up, got %v", queue)
+	}
+	if snapshot[1].Quantity.Cmp(ether("30")) != 0 {
+		t.Errorf("Expected the snapshot quantity to stay 30, got %v", snapshot[1].Quantity)
+	}
+
+	// the remainder is matched again once a new order takes the other side
+	graph.AddOrder(ringOrder(3, "2", "5", ringTokenA, ringTokenB))
+	fills = graph.Clear(32)
+	if len(fills) != 1 || !reflect.DeepEqual(fills[0].GetOrderIDs(), []uint64{3, 2}) {
+		t.Errorf("Expected the remainder of order 2 to match order 3, got %v", fills)
+	}
+}
+
+func TestRingGraphDropsDust(t *testing.T) {
+	graph := class.NewRingGraph()
+
+	// order 1 holds a single wei, what it is paid rounds down to nothing and the ring has no lap
+	dust := ringOrder(1, "0.5", "0", ringTokenA, ringTokenB)
+	dust.Quantity = big.NewInt(1)
+	graph.AddOrder(dust)
+	graph.AddOrder(ringOrder(2, "1.5", "10", ringTokenB, ringTokenA))
+	graph.AddOrder(ringOrder(3, "0.6", "10", ringTokenA, ringTokenB))
+
+	fills := graph.Clear(32)
+	if len(fills) != 1 || !reflect.DeepEqual(fills[0].GetOrderIDs(), []uint64{3, 2}) {
+		t.Fatalf("Expected the dust order to be dropped and order 3 to match, got %v", fills)
+	}
+	for _, order := range graph.GetQueue(ringTokenA, ringTokenB) {
+		if order.OrderID == 1 {
+			t.Errorf("Expected the dust order to leave its queue")
+		}
+	}
+}
+
+func TestRingGraphOCOSiblings(t *testing.T) {
+	groups := class.NewOCOGroups()
+	groups.Link(1, 7)
+
+	graph := class.NewRingGraph()
+	graph.SetOCOGroups(groups)
+	graph.AddOrder(ringOrder(1, "2", "10", ringTokenA, ringTokenB))
+	graph.AddOrder(ringOrder(2, "0.4", "20", ringTokenB, ringTokenA))
+	graph.AddOrder(ringOrder(7, "1", "10", ringTokenC, ringTokenD))
+
+	if fills := graph.Clear(32); len(fills) != 1 {
+		t.Fatalf("Expected one batch, got %v", fills)
+	}
+	if queue := graph.GetQueue(ringTokenC, ringTokenD); len(queue) != 0 {
+		t.Errorf("Expected the sibling of order 1 to leave the graph, got %v", queue)
+	}
+	if groups.IsCancelled(c.OrderID(7)) {
+		t.Errorf("Expected the groups to be left untouched by the graph")
+	}
+}
+
+func TestRingGraphBestCycle(t *testing.T) {
+	graph := class.NewRingGraph()
+	graph.AddOrder(ringOrder(1, "2", "10", ringTokenA, ringTokenB))
+	graph.AddOrder(ringOrder(2, "3", "20", ringTokenB, ringTokenC))
+	graph.AddOrder(ringOrder(3, "0.15", "60", ringTokenC, ringTokenA))
+	// B -> A closes a two leg ring that leaves more than the three leg one, 0.4 against 0.1
+	graph.AddOrder(ringOrder(4, "0.3", "10", ringTokenB, ringTokenA))
+
+	if path := graph.BestCycle(); !reflect.DeepEqual(path, []string{ringTokenA.Hex(), ringTokenB.Hex()}) {
+		t.Fatalf("Expected the two leg ring with the highest surplus, got %v", path)
+	}
+
+	// without it only the three leg ring is left, and it is longer than allowed
+	graph.RemoveOrder(4)
+	if path := graph.BestCycle(); len(path) != 3 {
+		t.Fatalf("Expected the three leg ring, got %v", path)
+	}
+	graph.SetMaxCycleLength(2)
+	if path := graph.BestCycle(); path != nil {
+		t.Errorf("Expected no ring within two legs, got %v", path)
+	}
+}
@@ -1,6 +1,10 @@
 package tests
 
 import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
 	"testing"
 
 	"orderbook.com/m/c"
@@ -242,3 +246,191 @@ func TestRBeginDescending(t *testing.T) {
 		t.Errorf("Expected order pointer to be %v, got %v", order2, order)
 	}
 }
+
+// Test for Iterate
+func TestIterate(t *testing.T) {
+	sm := class.NewSortedMap(true)
+
+	for i, price := range []c.Price{150, 120, 160, 130} {
+		sm.AddData(price, class.NewOrder(c.GoodTillCancel, c.OrderID(i), c.BUY, price, c.Quantity(10)))
+	}
+
+	visited := []c.Price{}
+	sm.Iterate(func(price c.Price, orders []*class.Order) bool {
+		visited = append(visited, price)
+		return price != 130
+	})
+
+	expectedKeys := []c.Price{160, 150, 130}
+	if fmt.Sprint(visited) != fmt.Sprint(expectedKeys) {
+		t.Errorf("Expected iteration to visit %v, got %v", expectedKeys, visited)
+	}
+}
+
+// Test for LowerBound and UpperBound
+func TestBounds(t *testing.T) {
+	asks := class.NewSortedMap(false)
+	bids := class.NewSortedMap(true)
+
+	for i, price := range []c.Price{100, 110, 120} {
+		asks.AddData(price, class.NewOrder(c.GoodTillCancel, c.OrderID(i), c.SELL, price, c.Quantity(10)))
+		bids.AddData(price, class.NewOrder(c.GoodTillCancel, c.OrderID(i), c.BUY, price, c.Quantity(10)))
+	}
+
+	tests := []struct {
+		name     string
+		bound    func(c.Price) (c.Price, []*class.Order)
+		price    c.Price
+		expected c.Price
+	}{
+		{"asks lower 105", asks.LowerBound, 105, 110},
+		{"asks lower 110", asks.LowerBound, 110, 110},
+		{"asks upper 110", asks.UpperBound, 110, 120},
+		{"asks upper 120", asks.UpperBound, 120, c.Price(math.NaN())},
+		{"bids lower 115", bids.LowerBound, 115, 110},
+		{"bids lower 110", bids.LowerBound, 110, 110},
+		{"bids upper 110", bids.UpperBound, 110, 100},
+		{"bids lower 90", bids.LowerBound, 90, c.Price(math.NaN())},
+	}
+
+	for _, tt := range tests {
+		price, orders := tt.bound(tt.price)
+		if math.IsNaN(float64(tt.expected)) {
+			if !math.IsNaN(float64(price)) || orders != nil {
+				t.Errorf("%v: expected no level, got %v", tt.name, price)
+			}
+			continue
+		}
+		if price != tt.expected || len(orders) != 1 {
+			t.Errorf("%v: expected level %v, got %v", tt.name, tt.expected, price)
+		}
+	}
+}
+
+// Test that random adds and erases keep the levels sorted
+func TestSortedMapRandomOperations(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for _, descending := range []bool{false, true} {
+		sm := class.NewSortedMap(descending)
+		expected := map[c.Price]bool{}
+
+		for i := 0; i < 5000; i++ {
+			price := c.Price(rng.Intn(500))
+			if rng.Intn(3) == 0 {
+				sm.Erase(price)
+				delete(expected, price)
+			} else {
+				sm.AddData(price, class.NewOrder(c.GoodTillCancel, c.OrderID(i), c.BUY, price, c.Quantity(1)))
+				expected[price] = true
+			}
+		}
+
+		keys := []c.Price{}
+		for price := range expected {
+			keys = append(keys, price)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if descending {
+				return keys[i] > keys[j]
+			}
+			return keys[i] < keys[j]
+		})
+
+		if fmt.Sprint(sm.SortData()) != fmt.Sprint(keys) {
+			t.Fatalf("Expected levels %v, got %v", keys, sm.SortData())
+		}
+		if sm.Len() != len(keys) {
+			t.Fatalf("Expected %v levels, got %v", len(keys), sm.Len())
+		}
+		if begin, _ := sm.Begin(); begin != keys[0] {
+			t.Errorf("Expected begin %v, got %v", keys[0], begin)
+		}
+		if rbegin, _ := sm.RBegin(); rbegin != keys[len(keys)-1] {
+			t.Errorf("Expected rbegin %v, got %v", keys[len(keys)-1], rbegin)
+		}
+	}
+}
+
+func newBenchmarkSortedMap(levels int) *class.SortedMap {
+	sm := class.NewSortedMap(true)
+	for _, i := range rand.New(rand.NewSource(1)).Perm(levels) {
+		price := c.Price(i)
+		sm.AddData(price, class.NewOrder(c.GoodTillCancel, c.OrderID(i), c.BUY, price, c.Quantity(10)))
+	}
+	return sm
+}
+
+// Best price access should not depend on the number of levels
+func BenchmarkBegin(b *testing.B) {
+	for _, levels := range []int{10, 1000, 100000} {
+		sm := newBenchmarkSortedMap(levels)
+		b.Run(fmt.Sprintf("levels=%d", levels), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sm.Begin()
+			}
+		})
+	}
+}
+
+func BenchmarkRBegin(b *testing.B) {
+	for _, levels := range []int{10, 1000, 100000} {
+		sm := newBenchmarkSortedMap(levels)
+		b.Run(fmt.Sprintf("levels=%d", levels), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sm.RBegin()
+			}
+		})
+	}
+}
+
+func BenchmarkAddEraseLevel(b *testing.B) {
+	for _, levels := range []int{10, 1000, 100000} {
+		sm := newBenchmarkSortedMap(levels)
+		order := class.NewOrder(c.GoodTillCancel, c.OrderID(0), c.BUY, c.Price(0.5), c.Quantity(10))
+		b.Run(fmt.Sprintf("levels=%d", levels), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				price := c.Price(float64(i%levels) + 0.5)
+				sm.AddData(price, order)
+				sm.Erase(price)
+			}
+		})
+	}
+}
+
+// Test for RemoveOrder
+func TestRemoveOrder(t *testing.T) {
+	sm := class.NewSortedMap(false)
+
+	order1 := class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(150), c.Quantity(10))
+	order2 := class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(150), c.Quantity(10))
+	order3 := class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.SELL, c.Price(150), c.Quantity(10))
+
+	sm.AddData(order1.GetPrice(), order1)
+	sm.AddData(order2.GetPrice(), order2)
+	sm.AddData(order3.GetPrice(), order3)
+
+	// Test removing from the middle of the queue
+	if !sm.RemoveOrder(order2) {
+		t.Fatal("Expected order2 to be removed")
+	}
+	orders, _ := sm.At(c.Price(150))
+	if len(orders) != 2 || orders[0] != order1 || orders[1] != order3 {
+		t.Errorf("Expected [%v, %v] to remain in order, got %v", order1, order3, orders)
+	}
+
+	// Test removing an order that is not resting
+	if sm.RemoveOrder(order2) {
+		t.Error("Expected removing order2 twice to fail")
+	}
+
+	// Test the level is dropped with its last order
+	sm.PopFront(c.Price(150))
+	if sm.Front() != order3 {
+		t.Errorf("Expected order3 at the front, got %v", sm.Front())
+	}
+	sm.RemoveOrder(order3)
+	if !sm.Empty() {
+		t.Errorf("Expected empty sorted map, got %v", sm.GetData())
+	}
+}
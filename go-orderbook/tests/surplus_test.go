@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"orderbook.com/m/class"
+)
+
+func TestNegativeCycle(t *testing.T) {
+	edges := []class.RingEdge{
+		{From: "A", To: "B", Price: ether("2")},
+		{From: "B", To: "A", Price: ether("0.6")},
+		{From: "B", To: "C", Price: ether("3")},
+		{From: "C", To: "A", Price: ether("0.1")},
+	}
+
+	// A -> B -> A multiplies to 1.2, A -> B -> C -> A to 0.6
+	cycle := class.NegativeCycle(edges)
+	if len(cycle) != 3 {
+		t.Fatalf("Expected the three leg ring, got edges %v", cycle)
+	}
+	for i, index := range cycle {
+		next := edges[cycle[(i+1)%len(cycle)]]
+		if edges[index].To != next.From {
+			t.Errorf("Edge %v does not lead into edge %v", edges[index], next)
+		}
+	}
+}
+
+func TestNegativeCycleNoSurplus(t *testing.T) {
+	edges := []class.RingEdge{
+		{From: "A", To: "B", Price: ether("2")},
+		{From: "B", To: "A", Price: ether("0.5")},
+		{From: "B", To: "C", Price: ether("3")},
+		{From: "C", To: "A", Price: ether("0.4")},
+	}
+
+	// both rings multiply to one or more
+	if cycle := class.NegativeCycle(edges); cycle != nil {
+		t.Errorf("Expected no ring with a surplus, got edges %v", cycle)
+	}
+	if cycle := class.NegativeCycle(nil); cycle != nil {
+		t.Errorf("Expected no ring in an empty graph, got edges %v", cycle)
+	}
+}
+
+func TestSplitSurplus(t *testing.T) {
+	tokenA := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	tokenB := common.HexToAddress("0x0000000000000000000000000000000000000002")
+	alice := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	bob := common.HexToAddress("0x00000000000000000000000000000000000000b0")
+
+	ring := []class.ChainOrder{
+		{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 1, Price: ether("2"), Quantity: ether("10"), TokenPair0: tokenA, TokenPair1: tokenB},
+		{UserAddress: bob, OrderType: class.ChainLimit, OrderID: 2, Price: ether("0.4"), Quantity: ether("20"), TokenPair0: tokenB, TokenPair1: tokenA},
+	}
+
+	surplus, err := class.SplitSurplus(ring, []*big.Int{ether("10"), ether("20")})
+	if err != nil {
+		t.Fatalf("SplitSurplus failed: %v", err)
+	}
+	if surplus.Rate.Cmp(ether("0.2")) != 0 {
+		t.Errorf("Expected a rate of 0.2 ether, got %v", surplus.Rate)
+	}
+
+	if leg := surplus.Legs[0]; leg.UserAddress != alice || leg.Token != tokenB || leg.Paid.Cmp(ether("20")) != 0 || leg.Surplus.Sign() != 0 {
+		t.Errorf("Expected alice to be paid 20 B with nothing left, got %+v", leg)
+	}
+	if leg := surplus.Legs[1]; leg.UserAddress != bob || leg.Token != tokenA || leg.Paid.Cmp(ether("8")) != 0 || leg.Surplus.Cmp(ether("2")) != 0 {
+		t.Errorf("Expected bob to be paid 8 A with 2 A left over, got %+v", leg)
+	}
+
+	if _, err := class.SplitSurplus(ring, []*big.Int{ether("10"), ether("19")}); err == nil {
+		t.Errorf("Expected an error when the next order does not deliver the price")
+	}
+
+	broken := []class.ChainOrder{ring[0], ring[0]}
+	if _, err := class.SplitSurplus(broken, []*big.Int{ether("1"), ether("2")}); err == nil {
+		t.Errorf("Expected an error for a ring whose tokens do not connect")
+	}
+}
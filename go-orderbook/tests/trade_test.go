@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"orderbook.com/m/c"
+	"orderbook.com/m/class"
+)
+
+func TestTradeRecord(t *testing.T) {
+	clock := newFakeClock(sessionStart)
+	ob := class.NewOrderbook()
+	ob.SetClock(clock)
+
+	if err := ob.SetFeeSchedule(class.FeeSchedule{MakerFeeBps: -2, TakerFeeBps: 5}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(1), c.SELL, c.Price(50), c.Quantity(4)))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(2), c.SELL, c.Price(52), c.Quantity(4)))
+
+	clock.Advance(time.Second)
+	trades, _ := ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(3), c.BUY, c.Price(55), c.Quantity(6)))
+	if len(trades) != 2 {
+		t.Fatalf("Expected 2 trades, got %v", trades)
+	}
+
+	first := trades[0]
+	if first.GetPrice() != 50 || first.GetQuantity() != 4 {
+		t.Errorf("Expected first trade of 4 at the maker price 50, got %v at %v", first.GetQuantity(), first.GetPrice())
+	}
+	if first.GetTakerSide() != c.BUY || first.GetMakerSide() != c.SELL {
+		t.Errorf("Expected the buyer to be the taker, got taker %v maker %v", first.GetTakerSide(), first.GetMakerSide())
+	}
+	if first.GetTakerOrderID() != 3 || first.GetMakerOrderID() != 1 {
+		t.Errorf("Expected taker 3 and maker 1, got taker %v maker %v", first.GetTakerOrderID(), first.GetMakerOrderID())
+	}
+	if !first.GetTimestamp().Equal(sessionStart.Add(time.Second)) {
+		t.Errorf("Expected trade timestamp from the book clock, got %v", first.GetTimestamp())
+	}
+	if math.Abs(first.GetTakerFee()-0.1) > 1e-9 || math.Abs(first.GetMakerFee()+0.04) > 1e-9 {
+		t.Errorf("Expected taker fee 0.1 and maker rebate 0.04, got %v and %v", first.GetTakerFee(), first.GetMakerFee())
+	}
+
+	second := trades[1]
+	if second.GetPrice() != 52 || second.GetQuantity() != 2 {
+		t.Errorf("Expected second trade of 2 at 52, got %v at %v", second.GetQuantity(), second.GetPrice())
+	}
+	if first.GetSequence() != 1 || second.GetSequence() != 2 {
+		t.Errorf("Expected sequence 1 and 2, got %v and %v", first.GetSequence(), second.GetSequence())
+	}
+
+	// a resting bid hit by a seller trades at the bid price
+	ob.CancelOrder(c.OrderID(2))
+	ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(4), c.BUY, c.Price(48), c.Quantity(1)))
+	trades, _ = ob.AddOrder(class.NewOrder(c.GoodTillCancel, c.OrderID(5), c.SELL, c.Price(47), c.Quantity(1)))
+	if len(trades) != 1 || trades[0].GetPrice() != 48 || trades[0].GetTakerSide() != c.SELL || trades[0].GetSequence() != 3 {
+		t.Errorf("Expected the seller to take the 48 bid as trade 3, got %v", trades)
+	}
+}
+
+func TestFeeScheduleValidation(t *testing.T) {
+	ob := class.NewOrderbook()
+
+	invalid := []class.FeeSchedule{
+		{MakerFeeBps: 0, TakerFeeBps: -1},
+		{MakerFeeBps: -6, TakerFeeBps: 5},
+		{MakerFeeBps: 10000, TakerFeeBps: 5},
+	}
+	for _, schedule := range invalid {
+		if err := ob.SetFeeSchedule(schedule); err == nil {
+			t.Errorf("Expected schedule %+v to be rejected, got none", schedule)
+		}
+	}
+
+	if ob.GetFeeSchedule() != (class.FeeSchedule{}) {
+		t.Errorf("Expected a rejected schedule to leave the fees unchanged, got %+v", ob.GetFeeSchedule())
+	}
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"orderbook.com/m/class"
+)
+
+func TestTrailingStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trailing_stops.json")
+	ts, err := class.NewTrailingStops(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	market := class.Market{TokenIn: tokenLow, TokenOut: tokenHigh}
+
+	// the chain price is high enough that matchTrade accepts the stop anywhere below 5
+	stop := class.ChainOrder{UserAddress: alice, OrderType: class.ChainStop, OrderID: 1, Price: ether("5"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh}
+	if err := ts.Add(stop, class.Trail{Amount: ether("0.5")}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, price := range []string{"2", "2.4", "3", "2.8"} {
+		if fired, err := ts.Update(market, ether(price)); len(fired) != 0 || err != nil {
+			t.Fatalf("Expected nothing to fire at %v, got %v %v", price, fired, err)
+		}
+	}
+
+	got, _ := ts.GetTrailingStop(1)
+	trigger, _ := got.TriggerPrice()
+	if got.Mark.Cmp(ether("3")) != 0 || trigger.Cmp(ether("2.5")) != 0 {
+		t.Errorf("Expected high-water mark 3 and trigger 2.5, got %v and %v", got.Mark, trigger)
+	}
+
+	// the mark survives a restart
+	reloaded, err := class.NewTrailingStops(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got, ok := reloaded.GetTrailingStop(1); !ok || got.Mark.Cmp(ether("3")) != 0 || got.Order.Price.Cmp(ether("5")) != 0 {
+		t.Fatalf("Expected the trailing stop to be reloaded with mark 3, got %+v", got)
+	}
+
+	fired, err := reloaded.Update(market, ether("2.5"))
+	if err != nil || !equalIDs(triggerIDs(fired), []uint64{1}) {
+		t.Errorf("Expected order 1 to fire at 2.5, got %v %v", triggerIDs(fired), err)
+	}
+
+	// it stays until the chain no longer has it
+	if err := reloaded.Sync(nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := reloaded.GetTrailingStop(1); ok {
+		t.Errorf("Expected the executed order to be dropped")
+	}
+}
+
+func TestTrailingLimitBps(t *testing.T) {
+	ts, _ := class.NewTrailingStops("")
+	market := class.Market{TokenIn: tokenLow, TokenOut: tokenHigh}
+
+	// a limit follows the low-water mark and fires once the price bounces 10% off it
+	limit := class.ChainOrder{UserAddress: bob, OrderType: class.ChainLimit, OrderID: 2, Price: ether("1"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh}
+	if err := ts.Add(limit, class.Trail{Bps: 1000}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, price := range []string{"3", "2", "2.1"} {
+		if fired, _ := ts.Update(market, ether(price)); len(fired) != 0 {
+			t.Fatalf("Expected nothing to fire at %v, got %v", price, triggerIDs(fired))
+		}
+	}
+	if fired, _ := ts.Update(market, ether("2.2")); !equalIDs(triggerIDs(fired), []uint64{2}) {
+		t.Errorf("Expected order 2 to fire at 2.2, got %v", triggerIDs(fired))
+	}
+
+	// the trailing order is kept away from the plain trigger index
+	orders := []class.ChainOrder{limit, {OrderType: class.ChainLimit, OrderID: 3, Price: big.NewInt(1), Quantity: big.NewInt(1)}}
+	if plain := ts.Exclude(orders); !equalIDs(triggerIDs(plain), []uint64{3}) {
+		t.Errorf("Expected only order 3 to be plain, got %v", triggerIDs(plain))
+	}
+}
+
+func TestTrailValidation(t *testing.T) {
+	ts, _ := class.NewTrailingStops("")
+	stop := class.ChainOrder{OrderType: class.ChainStop, OrderID: 1, Price: ether("1"), Quantity: ether("1")}
+
+	for _, trail := range []class.Trail{{}, {Amount: ether("1"), Bps: 10}, {Amount: big.NewInt(-1)}, {Bps: 10000}} {
+		if err := ts.Add(stop, trail); err == nil {
+			t.Errorf("Expected trail %+v to be rejected", trail)
+		}
+	}
+
+	stop.OrderType = class.ChainMarket
+	if err := ts.Add(stop, class.Trail{Bps: 10}); err == nil {
+		t.Errorf("Expected a market order to be rejected")
+	}
+}
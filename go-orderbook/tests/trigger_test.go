@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"math/big"
+	"testing"
+
+	"orderbook.com/m/class"
+	"orderbook.com/m/fixed"
+)
+
+func triggerIDs(orders []class.ChainOrder) []uint64 {
+	ids := []uint64{}
+	for _, order := range orders {
+		ids = append(ids, order.OrderID)
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTriggerEngine(t *testing.T) {
+	te := class.NewTriggerEngine()
+	market := class.Market{TokenIn: tokenLow, TokenOut: tokenHigh}
+
+	orders := []class.ChainOrder{
+		{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 1, Price: ether("2"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		{UserAddress: alice, OrderType: class.ChainLimit, OrderID: 2, Price: ether("1.5"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		{UserAddress: bob, OrderType: class.ChainLimit, OrderID: 3, Price: ether("3"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		{UserAddress: bob, OrderType: class.ChainStop, OrderID: 4, Price: ether("1"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		{UserAddress: bob, OrderType: class.ChainStop, OrderID: 5, Price: ether("0.5"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+		// the other direction is its own market with its own price
+		{UserAddress: bob, OrderType: class.ChainLimit, OrderID: 6, Price: ether("0.1"), Quantity: ether("1"), TokenPair0: tokenHigh, TokenPair1: tokenLow},
+		{UserAddress: bob, OrderType: class.ChainMarket, OrderID: 7, Price: ether("1"), Quantity: ether("1"), TokenPair0: tokenLow, TokenPair1: tokenHigh},
+	}
+	if err := te.Sync(orders); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if te.Len() != 6 || len(te.GetMarkets()) != 2 {
+		t.Fatalf("Expected 6 orders in 2 markets, got %v in %v", te.Len(), te.GetMarkets())
+	}
+
+	// between every trigger price nothing fires
+	if triggered := te.Trigger(market, ether("1.2")); len(triggered) != 0 {
+		t.Errorf("Expected nothing to trigger at 1.2, got %v", triggerIDs(triggered))
+	}
+
+	// limits fire once the market reaches their price, lowest first
+	if triggered := te.Trigger(market, ether("2")); !equalIDs(triggerIDs(triggered), []uint64{2, 1}) {
+		t.Errorf("Expected limits 2 and 1 at 2, got %v", triggerIDs(triggered))
+	}
+
+	// stops fire once the market falls to their price, highest first
+	if triggered := te.Trigger(market, ether("0.5")); !equalIDs(triggerIDs(triggered), []uint64{4, 5}) {
+		t.Errorf("Expected stops 4 and 5 at 0.5, got %v", triggerIDs(triggered))
+	}
+	if te.Len() != 2 {
+		t.Errorf("Expected triggered orders to leave the index, got %v orders", te.Len())
+	}
+
+	// a later snapshot drops the cancelled limit and brings back orders that are still open
+	if err := te.Sync(orders[:2]); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if te.Len() != 2 || len(te.GetMarkets()) != 1 {
+		t.Errorf("Expected only orders 1 and 2 left, got %v in %v", te.Len(), te.GetMarkets())
+	}
+	if !te.Remove(1) || te.Remove(1) {
+		t.Errorf("Expected order 1 to be removed exactly once")
+	}
+
+	if err := te.Add(orders[6]); err == nil {
+		t.Errorf("Expected a market order to be rejected")
+	}
+	if triggered := te.Trigger(market, nil); len(triggered) != 0 {
+		t.Errorf("Expected a missing price to trigger nothing, got %v", triggerIDs(triggered))
+	}
+}
+
+func TestStopLimit(t *testing.T) {
+	te := class.NewTriggerEngine()
+	market := class.Market{TokenIn: tokenLow, TokenOut: tokenHigh}
+
+	stop := class.ChainOrder{UserAddress: alice, OrderType: class.ChainStop, OrderID: 1, Price: ether("1"), Quantity: ether("10"), TokenPair0: tokenLow, TokenPair1: tokenHigh}
+	plain := class.ChainOrder{UserAddress: bob, OrderType: class.ChainStop, OrderID: 2, Price: ether("1"), Quantity: ether("10"), TokenPair0: tokenLow, TokenPair1: tokenHigh}
+
+	// the limit can be set before the order is seen in a snapshot
+	if err := te.SetStopLimit(1, ether("0.8")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := te.SetStopLimit(2, ether("0")); err == nil {
+		t.Errorf("Expected a zero limit price to be rejected")
+	}
+	if err := te.Sync([]class.ChainOrder{stop, plain}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// the pool pays amountOut per unit in, a fast move leaves it below the limit
+	payout := ether("0.7")
+	quote := func(amountIn *big.Int) (*big.Int, error) {
+		return fixed.Mul(amountIn, payout, fixed.Floor)
+	}
+
+	// the stop price triggers both but only the plain stop is handed out for a swap
+	if triggered := te.Trigger(market, ether("0.9")); !equalIDs(triggerIDs(triggered), []uint64{2}) {
+		t.Errorf("Expected only the plain stop to be triggered, got %v", triggerIDs(triggered))
+	}
+	if !te.IsArmed(1) {
+		t.Fatalf("Expected the stop-limit to be armed")
+	}
+
+	if _, ok, err := te.NextStopLimit(market, ether("0.9"), quote); ok || err != nil {
+		t.Errorf("Expected no execution below the limit, got %v %v", ok, err)
+	}
+
+	// the pool recovers past the limit while the price stays at or below the stop
+	payout = ether("0.8")
+	if _, ok, _ := te.NextStopLimit(market, ether("1.1"), quote); ok {
+		t.Errorf("Expected no execution above the stop price, matchTrade would revert")
+	}
+	order, ok, err := te.NextStopLimit(market, ether("0.95"), quote)
+	if !ok || err != nil || order.OrderID != 1 {
+		t.Fatalf("Expected order 1 to be executable, got %v %v %v", order.OrderID, ok, err)
+	}
+	if te.Len() != 0 || te.IsArmed(1) {
+		t.Errorf("Expected the executed stop-limit to leave the index, got %v orders", te.Len())
+	}
+
+	// a swap that failed leaves the order open on chain, it comes back as a stop-limit
+	if err := te.Sync([]class.ChainOrder{stop}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if limit, ok := te.GetStopLimit(1); !ok || limit.Cmp(ether("0.8")) != 0 {
+		t.Errorf("Expected the limit of 0.8 to be kept, got %v", limit)
+	}
+
+	// the limit is forgotten once the order is gone from the chain
+	te.Sync(nil)
+	if _, ok := te.GetStopLimit(1); ok {
+		t.Errorf("Expected the limit to be dropped with the order")
+	}
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"orderbook.com/m/class"
+	"orderbook.com/m/fixed"
+)
+
+// pool mirrors LiquidityPool for swaps of token A into token B
+type pool struct {
+	supplyIn, supplyOut *big.Int
+}
+
+func newPool(supplyIn, supplyOut string) *pool {
+	return &pool{supplyIn: ether(supplyIn), supplyOut: ether(supplyOut)}
+}
+
+func (p *pool) getAmountOut(amountIn *big.Int) (*big.Int, error) {
+	kept, err := fixed.MulDiv(p.supplyIn, p.supplyOut, new(big.Int).Add(p.supplyIn, amountIn), fixed.Floor)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Sub(p.supplyOut, kept), nil
+}
+
+func (p *pool) getMarketPrice() (*big.Int, error) {
+	return fixed.MulDiv(fixed.One(), p.supplyOut, new(big.Int).Add(p.supplyIn, fixed.One()), fixed.Floor)
+}
+
+func (p *pool) swap(amountIn *big.Int) (*big.Int, error) {
+	amountOut, _ := fixed.MulDiv(amountIn, p.supplyOut, new(big.Int).Add(p.supplyIn, amountIn), fixed.Floor)
+	p.supplyIn = new(big.Int).Add(p.supplyIn, amountIn)
+	p.supplyOut = new(big.Int).Sub(p.supplyOut, amountOut)
+	return amountOut, nil
+}
+
+// impactBps is how far the child's average price fell below the market price before it
+func impactBps(spot, amountIn, amountOut *big.Int) int64 {
+	paid := new(big.Int).Mul(amountOut, fixed.One())
+	ideal := new(big.Int).Mul(spot, amountIn)
+	shortfall := new(big.Int).Sub(ideal, paid)
+	return new(big.Int).Div(new(big.Int).Mul(shortfall, big.NewInt(10000)), ideal).Int64()
+}
+
+func TestTWAPSlicesEvenly(t *testing.T) {
+	p := newPool("1000", "2000")
+	twap, err := class.NewTWAP(class.TWAPParams{Total: ether("40"), Slices: 4, MaxImpactBps: 500}, p.getAmountOut, p.getMarketPrice, p.swap)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		size, err := twap.Step()
+		if err != nil || size.Cmp(ether("10")) != 0 {
+			t.Fatalf("Expected child %v of 10, got %v %v", i, size, err)
+		}
+	}
+
+	progress := twap.GetProgress()
+	if progress.Status != class.TWAPCompleted || progress.Children != 4 || progress.GetRemaining(ether("40")).Sign() != 0 {
+		t.Errorf("Expected the parent to complete in 4 children, got %+v", progress)
+	}
+	if _, err := twap.Step(); !errors.Is(err, class.ErrTWAPStopped) {
+		t.Errorf("Expected a completed parent to stop, got %v", err)
+	}
+	select {
+	case <-twap.Done():
+	default:
+		t.Errorf("Expected Done to be closed")
+	}
+
+	// the average of four small swaps is worse than spot but never below the cap
+	if average := progress.GetAveragePrice(); average.Cmp(ether("1.9")) < 0 || average.Cmp(ether("2")) >= 0 {
+		t.Errorf("Expected an average price between 1.9 and 2, got %v", average)
+	}
+}
+
+func TestTWAPCapsImpact(t *testing.T) {
+	p := newPool("100", "100")
+	twap, _ := class.NewTWAP(class.TWAPParams{Total: ether("50"), Slices: 2, MaxImpactBps: 300}, p.getAmountOut, p.getMarketPrice, p.swap)
+
+	for i := 0; i < 100 && twap.GetProgress().Status == class.TWAPRunning; i++ {
+		spot, _ := p.getMarketPrice()
+		before := new(big.Int).Set(p.supplyOut)
+
+		size, err := twap.Step()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if size.Sign() == 0 {
+			continue
+		}
+		if size.Cmp(ether("25")) > 0 {
+			t.Fatalf("Expected children of at most the even share, got %v", size)
+		}
+
+		received := new(big.Int).Sub(before, p.supplyOut)
+		if impact := impactBps(spot, size, received); impact > 300 {
+			t.Fatalf("Expected at most 300 bps of impact, child %v had %v", size, impact)
+		}
+	}
+
+	// an even share of 25 would cost about 20%, so the parent needs more children than slices
+	progress := twap.GetProgress()
+	if progress.Status != class.TWAPCompleted || progress.Children <= 2 {
+		t.Errorf("Expected the capped parent to finish in more than 2 children, got %+v", progress)
+	}
+}
+
+func TestTWAPCancelAndFail(t *testing.T) {
+	p := newPool("1000", "1000")
+	twap, _ := class.NewTWAP(class.TWAPParams{Total: ether("10"), Slices: 5, MaxImpactBps: 100}, p.getAmountOut, p.getMarketPrice, p.swap)
+
+	// two ticks are queued before Run starts, it stops when its ticks channel is closed
+	ticks := make(chan struct{}, 2)
+	ticks <- struct{}{}
+	ticks <- struct{}{}
+	close(ticks)
+	twap.Run(ticks)
+
+	twap.Cancel()
+	if _, err := twap.Step(); !errors.Is(err, class.ErrTWAPStopped) {
+		t.Errorf("Expected a cancelled parent to stop, got %v", err)
+	}
+
+	// Run returns right away once the parent is done
+	twap.Run(make(chan struct{}))
+
+	progress := twap.GetProgress()
+	if progress.Status != class.TWAPCancelled || progress.Children != 2 || progress.Executed.Cmp(ether("4")) != 0 {
+		t.Errorf("Expected 2 children of 2 before the cancel, got %+v", progress)
+	}
+
+	failing, _ := class.NewTWAP(class.TWAPParams{Total: ether("10"), Slices: 5, MaxImpactBps: 100}, p.getAmountOut, p.getMarketPrice,
+		func(*big.Int) (*big.Int, error) { return nil, errors.New("reverted") })
+	if _, err := failing.Step(); err == nil || failing.GetProgress().Status != class.TWAPFailed {
+		t.Errorf("Expected a reverted child to fail the parent, got %v", err)
+	}
+
+	for _, params := range []class.TWAPParams{{Total: ether("0"), Slices: 1, MaxImpactBps: 1}, {Total: ether("1"), Slices: 0, MaxImpactBps: 1}, {Total: ether("1"), Slices: 1, MaxImpactBps: 10000}} {
+		if _, err := class.NewTWAP(params, p.getAmountOut, p.getMarketPrice, p.swap); err == nil {
+			t.Errorf("Expected %+v to be rejected", params)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"orderbook.com/m/class"
+)
+
+// stubPricer returns fixed pool prices, a missing pair has no pool
+func stubPricer(prices map[[2]common.Address]*big.Int) class.PairPricer {
+	return func(tokenIn, tokenOut common.Address) (*big.Int, error) {
+		price, ok := prices[[2]common.Address{tokenIn, tokenOut}]
+		if !ok {
+			return nil, errors.New("no pool")
+		}
+		return price, nil
+	}
+}
+
+func violationKinds(violations []class.Violation) []class.ViolationKind {
+	kinds := []class.ViolationKind{}
+	for _, violation := range violations {
+		kinds = append(kinds, violation.Kind)
+	}
+	return kinds
+}
+
+func expectViolations(t *testing.T, violations []class.Violation, want ...class.ViolationKind) {
+	t.Helper()
+
+	got := violationKinds(violations)
+	if len(got) != len(want) {
+		t.Fatalf("Expected violations %v, got %v", want, violations)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected violations %v, got %v", want, violations)
+		}
+	}
+}
+
+func newRingVerifier(priceAB, priceBA string) *class.Verifier {
+	orders := []class.ChainOrder{
+		ringOrder(1, "2", "10", ringTokenA, ringTokenB),
+		ringOrder(2, "0.4", "30", ringTokenB, ringTokenA),
+	}
+	return class.NewVerifier(orders, stubPricer(map[[2]common.Address]*big.Int{
+		{ringTokenA, ringTokenB}: ether(priceAB),
+		{ringTokenB, ringTokenA}: ether(priceBA),
+	}))
+}
+
+func TestVerifyBatch(t *testing.T) {
+	verifier := newRingVerifier("3", "0.5")
+
+	expectViolations(t, verifier.Verify([]uint64{1, 2}, []*big.Int{ether("10"), ether("20")}))
+
+	violations := verifier.Verify([]uint64{1, 2}, []*big.Int{ether("10"), ether("19")})
+	expectViolations(t, violations, class.ViolationPricing)
+	if violations[0].Index != 0 || violations[0].OrderID != 1 {
+		t.Errorf("Expected the pricing violation on order 1 at 0, got %+v", violations[0])
+	}
+
+	expectViolations(t, verifier.Verify([]uint64{1, 1}, []*big.Int{ether("1"), ether("2")}),
+		class.ViolationCycle, class.ViolationCycle, class.ViolationPricing)
+
+	expectViolations(t, verifier.Verify([]uint64{1, 99}, []*big.Int{ether("10"), ether("20")}), class.ViolationUnknownOrder)
+	expectViolations(t, verifier.Verify([]uint64{1, 2}, []*big.Int{ether("10")}), class.ViolationLength)
+	expectViolations(t, verifier.Verify(nil, nil), class.ViolationEmpty)
+}
+
+func TestVerifyBatchPrices(t *testing.T) {
+	// matchTrade wants a limit price strictly below the market in a batch
+	verifier := newRingVerifier("2", "0.5")
+	violations := verifier.Verify([]uint64{1, 2}, []*big.Int{ether("10"), ether("20")})
+	expectViolations(t, violations, class.ViolationLimitPrice)
+	if violations[0].OrderID != 1 {
+		t.Errorf("Expected the limit violation on order 1, got %+v", violations[0])
+	}
+
+	stops := []class.ChainOrder{
+		ringOrder(1, "2", "10", ringTokenA, ringTokenB),
+		ringOrder(2, "0.4", "30", ringTokenB, ringTokenA),
+	}
+	stops[1].OrderType = class.ChainStop
+	verifier = class.NewVerifier(stops, stubPricer(map[[2]common.Address]*big.Int{
+		{ringTokenA, ringTokenB}: ether("3"),
+		{ringTokenB, ringTokenA}: ether("0.5"),
+	}))
+	expectViolations(t, verifier.Verify([]uint64{1, 2}, []*big.Int{ether("10"), ether("20")}), class.ViolationStopPrice)
+
+	verifier = class.NewVerifier(stops, stubPricer(nil))
+	expectViolations(t, verifier.Verify([]uint64{1, 2}, []*big.Int{ether("10"), ether("20")}),
+		class.ViolationMarketPrice, class.ViolationMarketPrice)
+}
+
+func TestVerifySingleOrder(t *testing.T) {
+	orders := []class.ChainOrder{
+		ringOrder(1, "2", "10", ringTokenA, ringTokenB),
+		ringOrder(2, "0.4", "30", ringTokenB, ringTokenA),
+		ringOrder(3, "1", "5", ringTokenA, ringTokenB),
+	}
+	orders[1].OrderType = class.ChainStop
+	orders[2].OrderType = class.ChainMarket
+
+	verifier := class.NewVerifier(orders, stubPricer(map[[2]common.Address]*big.Int{
+		{ringTokenA, ringTokenB}: ether("2"),
+		{ringTokenB, ringTokenA}: ether("0.5"),
+	}))
+
+	// a single limit trades at a market price equal to its own
+	expectViolations(t, verifier.Verify([]uint64{1}, []*big.Int{ether("10")}))
+	expectViolations(t, verifier.Verify([]uint64{1}, []*big.Int{ether("11")}), class.ViolationOverfill)
+	expectViolations(t, verifier.Verify([]uint64{2}, []*big.Int{ether("30")}), class.ViolationStopPrice)
+	expectViolations(t, verifier.Verify([]uint64{3}, []*big.Int{ether("5")}), class.ViolationOrderType)
+}
+
+func TestVerifyOverfillAndApply(t *testing.T) {
+	verifier := newRingVerifier("3", "0.5")
+
+	// order 1 is used up by its first trade, its second one would revert in _delOrderTrade,
+	// and order 2 only holds 30
+	violations := verifier.Verify([]uint64{1, 2, 1, 2}, []*big.Int{ether("10"), ether("20"), ether("8"), ether("16")})
+	expectViolations(t, violations, class.ViolationOverfill, class.ViolationOverfill)
+	if violations[0].Index != 2 || violations[1].Index != 3 {
+		t.Errorf("Expected the overfills at 2 and 3, got %v", violations)
+	}
+
+	verifier.Apply([]uint64{1, 2}, []*big.Int{ether("10"), ether("20")})
+	expectViolations(t, verifier.Verify([]uint64{1, 2}, []*big.Int{ether("10"), ether("20")}), class.ViolationUnknownOrder, class.ViolationOverfill)
+	expectViolations(t, verifier.Verify([]uint64{2}, []*big.Int{ether("10")}))
+	expectViolations(t, verifier.Verify([]uint64{2}, []*big.Int{ether("11")}), class.ViolationOverfill)
+}
+
+func TestVerifyRingFill(t *testing.T) {
+	legs := [][]class.ChainOrder{
+		{
+			ringOrder(1, "2", "10", ringTokenA, ringTokenB),
+			ringOrder(3, "2", "8", ringTokenA, ringTokenB),
+		},
+		{ringOrder(2, "0.4", "40", ringTokenB, ringTokenA)},
+	}
+
+	fill, err := class.FillRing(legs)
+	if err != nil {
+		t.Fatalf("FillRing failed: %v", err)
+	}
+
+	verifier := class.NewVerifier(append(legs[0], legs[1]...), stubPricer(map[[2]common.Address]*big.Int{
+		{ringTokenA, ringTokenB}: ether("3"),
+		{ringTokenB, ringTokenA}: ether("0.5"),
+	}))
+	expectViolations(t, verifier.Verify(fill.GetOrderIDs(), fill.Quantities))
+}